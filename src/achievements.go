@@ -0,0 +1,205 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// AchievementsPath is the file achievements are defined in.
+	AchievementsPath = "resources/achievements.json"
+	// UnlockedVersion is bumped whenever the unlocked achievements file
+	// changes format.
+	UnlockedVersion = 1
+)
+
+// Things which happen during a game that achievements are checked on.
+const (
+	OnBossDied    = "boss_died"
+	OnWon         = "won"
+	OnPlayerDied  = "player_died"
+	OnRoll        = "roll"
+	OnColorChange = "color_change"
+)
+
+// Achievement is a goal read from the achievements file. It unlocks when its
+// On trigger happens, in Level if given, while every stat is within Min and
+// Max. Stats are named as in StatValues.
+type Achievement struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	On          string             `json:"on"`
+	Level       string             `json:"level,omitempty"`
+	Min         map[string]float64 `json:"min,omitempty"`
+	Max         map[string]float64 `json:"max,omitempty"`
+}
+
+// Met returns true if the achievement is earned by on happening in level.
+func (a *Achievement) Met(on, level string, stats map[string]float64) bool {
+	if a.On != on || (a.Level != "" && a.Level != level) {
+		return false
+	}
+	for name, min := range a.Min {
+		if stats[name] < min {
+			return false
+		}
+	}
+	for name, max := range a.Max {
+		if stats[name] > max {
+			return false
+		}
+	}
+	return true
+}
+
+// StatValues names the stats achievements can test. The level stats are for
+// the level the trigger happened in.
+func StatValues(state *State, level string) map[string]float64 {
+	var (
+		stats = state.Stats
+	)
+	return map[string]float64{
+		"deaths":         float64(stats.Deaths),
+		"rolls":          float64(stats.Rolls),
+		"phases_cleared": float64(stats.PhasesCleared),
+		"color_changes":  float64(stats.ColorChanges),
+		"bosses_killed":  float64(stats.BossesKilled),
+		"playtime":       state.Playtime.Seconds(),
+		"level_deaths":   float64(stats.LevelDeaths[level]),
+		"level_time":     stats.LevelTime[level].Seconds(),
+		"attempt_deaths": float64(state.AttemptDeaths),
+	}
+}
+
+// Achievements are every achievement along with when each was unlocked. What
+// has been unlocked is kept across all save slots.
+type Achievements struct {
+	All      []*Achievement
+	Unlocked map[string]time.Time
+	path     string
+}
+
+// unlockedFile is how unlocked achievements are saved.
+type unlockedFile struct {
+	Version  int                  `json:"version"`
+	Unlocked map[string]time.Time `json:"unlocked"`
+}
+
+// LoadAchievements reads the achievement definitions at defs and what has
+// been unlocked from the file at path, which is where unlocks are saved. A
+// missing or unreadable unlocks file starts from nothing unlocked.
+func LoadAchievements(defs, path string) (a *Achievements, err error) {
+	var (
+		data     []byte
+		unlocked unlockedFile
+	)
+	a = &Achievements{
+		Unlocked: map[string]time.Time{},
+		path:     path,
+	}
+	if data, err = ioutil.ReadFile(defs); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &a.All); err != nil {
+		return nil, fmt.Errorf("Achievements file %v is corrupt: %v", defs, err)
+	}
+	if path == "" {
+		return
+	}
+	if data, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &unlocked); err != nil {
+		return a, fmt.Errorf("Unlocked achievements are corrupt: %v", err)
+	}
+	if unlocked.Version != UnlockedVersion {
+		return a, fmt.Errorf("Unlocked achievements are version %v, need %v", unlocked.Version, UnlockedVersion)
+	}
+	for id, at := range unlocked.Unlocked {
+		a.Unlocked[id] = at
+	}
+	return
+}
+
+// UnlockedPath returns the path of the unlocked achievements file in dir.
+func UnlockedPath(dir string) string {
+	return filepath.Join(dir, "achievements.json")
+}
+
+// Check unlocks every achievement earned by on happening in level and
+// returns the ones newly unlocked.
+func (a *Achievements) Check(on, level string, state *State) (unlocked []*Achievement) {
+	var (
+		stats map[string]float64
+	)
+	for _, achievement := range a.All {
+		if _, ok := a.Unlocked[achievement.ID]; ok {
+			continue
+		}
+		if stats == nil {
+			stats = StatValues(state, level)
+		}
+		if achievement.Met(on, level, stats) {
+			a.Unlocked[achievement.ID] = time.Now()
+			unlocked = append(unlocked, achievement)
+		}
+	}
+	if len(unlocked) > 0 {
+		if err := a.Write(); err != nil {
+			fmt.Printf("Could not save achievements: %v\n", err)
+		}
+	}
+	return
+}
+
+// Write saves what has been unlocked.
+func (a *Achievements) Write() (err error) {
+	var (
+		data []byte
+	)
+	if a.path == "" {
+		return
+	}
+	if data, err = json.MarshalIndent(unlockedFile{UnlockedVersion, a.Unlocked}, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(a.path, data)
+}
+
+// loadAchievements reads the achievements and which have been unlocked.
+// Without them there's just nothing to unlock, so errors aren't fatal.
+func (a *Application) loadAchievements() *Achievements {
+	var (
+		path = ""
+	)
+	if a.saveDir != "" {
+		path = UnlockedPath(a.saveDir)
+	}
+	achievements, err := LoadAchievements(AchievementsPath, path)
+	if err != nil {
+		fmt.Printf("Could not load achievements: %v\n", err)
+	}
+	return achievements
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+)
+
+// MusicSection is part of a track, from Start to End seconds in, which loops
+// while the music is at its Intensity.
+type MusicSection struct {
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	Intensity int     `json:"intensity"`
+}
+
+// IntensityRule raises the music to Intensity while every condition it sets
+// holds: the boss is in State, has at most ColorsLeft colors left, or is
+// Within that many world units of the player.
+type IntensityRule struct {
+	State      string  `json:"state,omitempty"`
+	ColorsLeft *int    `json:"colors_left,omitempty"`
+	Within     float32 `json:"within,omitempty"`
+	Intensity  int     `json:"intensity"`
+}
+
+// MusicSignals are what's going on in the game that the music reacts to.
+// State is empty when there's no boss to fight.
+type MusicSignals struct {
+	State      string
+	ColorsLeft int
+	Distance   float32
+}
+
+// Matches returns true if every condition of the rule holds.
+func (r *IntensityRule) Matches(s MusicSignals) bool {
+	if s.State == "" {
+		return false
+	}
+	if r.State != "" && r.State != s.State {
+		return false
+	}
+	if r.ColorsLeft != nil && s.ColorsLeft > *r.ColorsLeft {
+		return false
+	}
+	if r.Within > 0 && s.Distance > r.Within {
+		return false
+	}
+	return true
+}
+
+// Signal picks the music's intensity from the highest matching rule of the
+// level being played, switching sections if it changes.
+func (p *MusicPlayer) Signal(s MusicSignals) {
+	var (
+		intensity = 0
+		v         = &p.voices[p.current]
+	)
+	for i := range p.rules {
+		if rule := &p.rules[i]; rule.Intensity > intensity && rule.Matches(s) {
+			intensity = rule.Intensity
+		}
+	}
+	if intensity == p.intensity {
+		return
+	}
+	p.intensity = intensity
+	if section := p.sectionFor(v.track, intensity); section != v.section {
+		p.switchSection(section)
+	}
+}
+
+// sectionFor returns the section of track to play at intensity: the most
+// intense one no more intense than that, or the first. Returns -1 if the
+// track isn't split into sections.
+func (p *MusicPlayer) sectionFor(track string, intensity int) int {
+	var (
+		t     = p.config.Tracks[track]
+		found = -1
+	)
+	if t == nil || len(t.Sections) == 0 {
+		return -1
+	}
+	for i, section := range t.Sections {
+		if section.Intensity > intensity {
+			continue
+		}
+		if found < 0 || section.Intensity > t.Sections[found].Intensity {
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0
+	}
+	return found
+}
+
+// switchSection crossfades into the same point in another section of the
+// current track, so that sections written over the same beat stay in time.
+// Switching back to the section still fading out fades it back in.
+func (p *MusicPlayer) switchSection(section int) {
+	var (
+		v     = &p.voices[p.current]
+		track = p.config.Tracks[v.track]
+		from  = track.Sections[v.section]
+		to    = track.Sections[section]
+		into  = v.at() - seconds(from.Start)
+	)
+	p.crossfade(v.track, section, seconds(to.Start)+into%seconds(to.End-to.Start), seconds(track.SwitchFade))
+}
+
+// musicSignals reads what the music reacts to from the level.
+func (l *GameLayer) musicSignals() (s MusicSignals) {
+	var (
+		boss = l.level.Boss
+	)
+	if boss == nil || boss.Dead || len(boss.StateStack) == 0 {
+		return
+	}
+	if state, ok := boss.StateStack[len(boss.StateStack)-1].(fmt.Stringer); ok {
+		s.State = state.String()
+	}
+	s.ColorsLeft = len(boss.Colors)
+	s.Distance = boss.Pos().Sub(l.level.Player.Pos().Vec2).Len()
+	return
+}
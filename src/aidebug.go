@@ -0,0 +1,272 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"image/color"
+	"math"
+)
+
+const (
+	// circleSegments is how many lines approximate the detection radius.
+	circleSegments = 48
+)
+
+var (
+	pathStyle = &twodee.LineStyle{
+		Thickness: 0.15,
+		Color:     color.RGBA{255, 0, 255, 128},
+	}
+	targetStyle = &twodee.LineStyle{
+		Thickness: 0.1,
+		Color:     color.RGBA{255, 255, 0, 192},
+	}
+	radiusStyle = &twodee.LineStyle{
+		Thickness: 0.05,
+		Color:     color.RGBA{255, 255, 255, 96},
+	}
+	patternStyle = &twodee.LineStyle{
+		Thickness: 0.05,
+		Color:     color.RGBA{0, 255, 255, 96},
+	}
+	waypointStyle = &twodee.LineStyle{
+		Thickness: 0.1,
+		Color:     color.RGBA{0, 255, 255, 192},
+	}
+	seenStyle = &twodee.LineStyle{
+		Thickness: 0.05,
+		Color:     color.RGBA{0, 255, 0, 192},
+	}
+	unseenStyle = &twodee.LineStyle{
+		Thickness: 0.05,
+		Color:     color.RGBA{255, 0, 0, 192},
+	}
+)
+
+// AIDebug draws what the boss is thinking: its state stack, what it can see
+// and where it's going. Shown in debug mode, along with how the sound
+// channels are being shared.
+type AIDebug struct {
+	text   *twodee.TextRenderer
+	font   *twodee.FontFace
+	camera *twodee.Camera
+	cache  []*twodee.TextCache
+	audio  *twodee.TextCache
+}
+
+func NewAIDebug(winb twodee.Rectangle) (d *AIDebug, err error) {
+	var (
+		camera *twodee.Camera
+		font   *twodee.FontFace
+	)
+	if font, err = twodee.NewFontFace("resources/fonts/slkscr.ttf", 16, color.RGBA{255, 255, 255, 255}, color.Transparent); err != nil {
+		return
+	}
+	if camera, err = twodee.NewCamera(winb, winb); err != nil {
+		return
+	}
+	d = &AIDebug{
+		font:   font,
+		camera: camera,
+		cache:  []*twodee.TextCache{},
+	}
+	return
+}
+
+func (d *AIDebug) Reset() (err error) {
+	if d.text != nil {
+		d.text.Delete()
+	}
+	if d.text, err = twodee.NewTextRenderer(d.camera); err != nil {
+		return
+	}
+	for _, c := range d.cache {
+		c.Clear()
+	}
+	if d.audio != nil {
+		d.audio.Clear()
+	}
+	return
+}
+
+func (d *AIDebug) Delete() {
+	if d.text != nil {
+		d.text.Delete()
+		d.text = nil
+	}
+	for _, c := range d.cache {
+		c.Delete()
+	}
+	d.cache = d.cache[:0]
+	if d.audio != nil {
+		d.audio.Delete()
+		d.audio = nil
+	}
+}
+
+// DrawAudio shows the channel pool's counters in the top right of the
+// screen.
+func (d *AIDebug) DrawAudio(pool *ChannelPool) {
+	if d.audio == nil {
+		d.audio = twodee.NewTextCache(d.font)
+	}
+	d.audio.SetText(pool.String())
+	if texture := d.audio.Texture; texture != nil {
+		var (
+			bounds = d.camera.WorldBounds
+		)
+		d.text.Bind()
+		d.text.Draw(texture, bounds.Max.X()-float32(texture.Width)-10, bounds.Max.Y()-float32(texture.Height))
+		d.text.Unbind()
+	}
+}
+
+// Draw draws the overlay for the level's boss. World space geometry is drawn
+// with lines, which must use the game camera.
+func (d *AIDebug) Draw(level *Level, lines *twodee.LinesRenderer) {
+	if level.Boss == nil {
+		return
+	}
+	lines.Bind()
+	d.drawPerception(level, lines)
+	d.drawPattern(level, lines)
+	d.drawPath(level, lines)
+	lines.Unbind()
+	d.drawStack(level.Boss)
+}
+
+// drawPerception draws the detection radius and a ray to the player, green if
+// the boss has a clear line of sight to them and red if not.
+func (d *AIDebug) drawPerception(level *Level, lines *twodee.LinesRenderer) {
+	var (
+		boss   = level.Boss
+		mpv    = boss.Pos().Vec2
+		ppv    = level.Player.Pos().Vec2
+		circle = make([]mgl32.Vec2, circleSegments)
+		style  = unseenStyle
+	)
+	for i := range circle {
+		a := 2 * math.Pi * float64(i) / circleSegments
+		circle[i] = mpv.Add(mgl32.Vec2{
+			float32(math.Cos(a)) * boss.DetectionRadius,
+			float32(math.Sin(a)) * boss.DetectionRadius,
+		})
+	}
+	lines.Draw(twodee.NewLineGeometry(circle, true), mgl32.Ident4(), radiusStyle)
+	if level.BossCollisions.CanSee(mpv, ppv, 0.5, 0.5) {
+		style = seenStyle
+	}
+	lines.Draw(twodee.NewLineGeometry([]mgl32.Vec2{mpv, ppv}, false), mgl32.Ident4(), style)
+}
+
+// drawPattern draws the search pattern as a loop with a marker on each
+// waypoint. The waypoint currently being searched for is highlighted.
+func (d *AIDebug) drawPattern(level *Level, lines *twodee.LinesRenderer) {
+	var (
+		boss    = level.Boss
+		pattern = boss.SearchPattern()
+		target  = -1
+	)
+	if len(pattern) == 0 {
+		return
+	}
+	for _, s := range boss.StateStack {
+		if search, ok := s.(*SearchState); ok {
+			target = search.targetPointIdx
+		}
+	}
+	if len(pattern) > 1 {
+		lines.Draw(twodee.NewLineGeometry(pattern, true), mgl32.Ident4(), patternStyle)
+	}
+	for i, p := range pattern {
+		style := waypointStyle
+		if i == target {
+			style = targetStyle
+		}
+		lines.Draw(diamond(p, 0.25), mgl32.Ident4(), style)
+	}
+}
+
+// drawPath draws where the boss is headed and the spot it's investigating.
+func (d *AIDebug) drawPath(level *Level, lines *twodee.LinesRenderer) {
+	var (
+		boss  = level.Boss
+		stack = boss.StateStack
+	)
+	if len(level.BossPath) > 0 {
+		points := append([]mgl32.Vec2{boss.Pos().Vec2}, level.BossPath...)
+		lines.Draw(twodee.NewLineGeometry(points, false), mgl32.Ident4(), pathStyle)
+	}
+	if len(stack) == 0 {
+		return
+	}
+	if investigate, ok := stack[len(stack)-1].(*InvestigateState); ok {
+		lines.Draw(diamond(investigate.Target, 0.5), mgl32.Ident4(), targetStyle)
+	}
+}
+
+// drawStack lists the boss's states in the top left of the screen, the
+// current state first.
+func (d *AIDebug) drawStack(boss *Boss) {
+	var (
+		stack = boss.StateStack
+		y     = d.camera.WorldBounds.Max.Y()
+	)
+	for len(d.cache) < len(stack)+1 {
+		d.cache = append(d.cache, twodee.NewTextCache(d.font))
+	}
+	d.text.Bind()
+	for i := 0; i <= len(stack); i++ {
+		var label string
+		if i == 0 {
+			label = fmt.Sprintf("%v phase %v/%v", boss.Name, boss.Phase+1, boss.Phase+1+len(boss.Colors))
+		} else {
+			label = stateLabel(boss, stack[len(stack)-i])
+		}
+		d.cache[i].SetText(label)
+		if texture := d.cache[i].Texture; texture != nil {
+			y = y - float32(texture.Height)
+			d.text.Draw(texture, 10, y)
+		}
+	}
+	d.text.Unbind()
+}
+
+// stateLabel describes a state along with any timer it's counting down.
+func stateLabel(boss *Boss, s MobState) string {
+	switch state := s.(type) {
+	case *HuntState:
+		return fmt.Sprintf("%v bored %.1f/%.1fs", state.Name, state.durSinceLastContact.Seconds(), boss.BoredThreshold.Seconds())
+	case *InvestigateState:
+		return fmt.Sprintf("%v looked %.1f/%.1fs", state.Name, state.looked.Seconds(), state.LookAround.Seconds())
+	case *StaggerState:
+		return fmt.Sprintf("%v %.1f/%.1fs", state.Name, state.elapsed.Seconds(), state.Duration.Seconds())
+	case fmt.Stringer:
+		return state.String()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+func diamond(p mgl32.Vec2, r float32) *twodee.LineGeometry {
+	return twodee.NewLineGeometry([]mgl32.Vec2{
+		mgl32.Vec2{p[0] - r, p[1]},
+		mgl32.Vec2{p[0], p[1] + r},
+		mgl32.Vec2{p[0] + r, p[1]},
+		mgl32.Vec2{p[0], p[1] - r},
+	}, true)
+}
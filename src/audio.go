@@ -14,148 +14,119 @@
 
 package main
 
-import twodee "../lib/twodee"
+import (
+	"../lib/twodee"
+	"time"
+)
 
 type AudioSystem struct {
-	app                         *Application
-	bgm                         *twodee.Music
-	bossMusic                   *twodee.Music
-	bossDeathEffect             *twodee.SoundEffect
-	colorChangeEffect           *twodee.SoundEffect
-	playerDeathEffect           *twodee.SoundEffect
-	rollEffect                  *twodee.SoundEffect
-	bgmObserverId               int
-	bossMusicObserverId         int
-	pauseMusicObserverId        int
-	resumeMusicObserverId       int
-	bossDeathEffectObserverId   int
-	colorChangeEffectObserverId int
-	playerDeathEffectObserverId int
-	rollEffectObserverId        int
-	musicToggle                 int32
+	app    *Application
+	music  *MusicPlayer
+	sounds []*Sound
+	subs   Subscriptions
+	// now is how long the audio system has been running, for sound
+	// cooldowns.
+	now time.Duration
+	// Mixer sets the volume of everything played.
+	Mixer *Mixer
+	// Channels plays sound effects.
+	Channels *ChannelPool
+	// Listener hears sounds which happen somewhere in the world.
+	Listener Listener
 }
 
-func (a *AudioSystem) PlayBackgroundMusic(e twodee.GETyper) {
-	if a.musicToggle == 1 {
-		if twodee.MusicIsPlaying() {
-			twodee.PauseMusic()
-		}
-		a.bgm.Play(-1)
-	}
-}
-
-func (a *AudioSystem) PlayBossMusic(e twodee.GETyper) {
-	if a.musicToggle == 1 {
-		if twodee.MusicIsPlaying() {
-			twodee.PauseMusic()
-		}
-		a.bossMusic.Play(-1)
-	}
+// PlayMusic fades to the music for the level being loaded.
+func (a *AudioSystem) PlayMusic(e *MusicEvent) {
+	a.music.PlayLevel(e.Level)
 }
 
+// PauseMusic turns the music off.
 func (a *AudioSystem) PauseMusic(e twodee.GETyper) {
-	if a.musicToggle == 1 {
-		if twodee.MusicIsPlaying() {
-			twodee.PauseMusic()
-		}
-	}
+	a.music.SetOn(false)
 }
 
+// ResumeMusic turns the music back on.
 func (a *AudioSystem) ResumeMusic(e twodee.GETyper) {
-	if a.musicToggle == 1 {
-		if twodee.MusicIsPaused() {
-			twodee.ResumeMusic()
-		}
-	}
+	a.music.SetOn(true)
 }
 
-func (a *AudioSystem) PlayBossDeathEffect(e twodee.GETyper) {
-	if a.bossDeathEffect.IsPlaying(2) == 0 {
-		a.bossDeathEffect.PlayChannel(2, 1)
-	}
+// Signal lets the music react to what's going on in the game.
+func (a *AudioSystem) Signal(s MusicSignals) {
+	a.music.Signal(s)
 }
 
-func (a *AudioSystem) PlayColorChangeEffect(e twodee.GETyper) {
-	if a.colorChangeEffect.IsPlaying(3) == 0 {
-		a.colorChangeEffect.PlayChannel(3, 1)
-	}
+// Update fades the music and cools down sounds.
+func (a *AudioSystem) Update(elapsed time.Duration) {
+	a.now += elapsed
+	a.music.Update(elapsed)
 }
 
-func (a *AudioSystem) PlayPlayerDeathEffect(e twodee.GETyper) {
-	if a.playerDeathEffect.IsPlaying(4) == 0 {
-		a.playerDeathEffect.PlayChannel(4, 1)
-	}
+// SetVolumes sets the master, music and sound effect bus volumes, from 0 to
+// 100.
+func (a *AudioSystem) SetVolumes(master, music, effects int) {
+	a.Mixer.SetLevel(MasterBus, master)
+	a.Mixer.SetLevel(MusicBus, music)
+	a.Mixer.SetLevel(EffectsBus, effects)
 }
 
-func (a *AudioSystem) PlayRollEffect(e twodee.GETyper) {
-	if a.rollEffect.IsPlaying(5) == 0 {
-		a.rollEffect.PlayChannel(5, 1)
-	}
+// addSound plays sound whenever an event of type t happens. Sound events
+// are heard from where they happened.
+func (a *AudioSystem) addSound(t twodee.GameEventType, sound *Sound) {
+	a.sounds = append(a.sounds, sound)
+	a.subs.Add(Subscribe(a.app.GameEventHandler, t, func(e twodee.GETyper) {
+		var (
+			at *Placement
+		)
+		if event, ok := e.(*SoundEvent); ok {
+			placement := a.Listener.Place(event.Pos, sound.Entry.HearingRange())
+			at = &placement
+		}
+		sound.Play(a.Channels, a.now, at)
+	}))
 }
 
 func (a *AudioSystem) Delete() {
-	a.app.GameEventHandler.RemoveObserver(PlayBackgroundMusic, a.bgmObserverId)
-	a.app.GameEventHandler.RemoveObserver(PlayBossMusic, a.bossMusicObserverId)
-	a.app.GameEventHandler.RemoveObserver(PlayBossDeathEffect, a.bossDeathEffectObserverId)
-	a.app.GameEventHandler.RemoveObserver(PlayColorChangeEffect, a.colorChangeEffectObserverId)
-	a.app.GameEventHandler.RemoveObserver(PlayPlayerDeathEffect, a.playerDeathEffectObserverId)
-	a.app.GameEventHandler.RemoveObserver(PlayRollEffect, a.rollEffectObserverId)
-	a.app.GameEventHandler.RemoveObserver(PauseMusic, a.pauseMusicObserverId)
-	a.app.GameEventHandler.RemoveObserver(ResumeMusic, a.resumeMusicObserverId)
-	a.bgm.Delete()
-	a.bossMusic.Delete()
-	a.bossDeathEffect.Delete()
-	a.colorChangeEffect.Delete()
-	a.playerDeathEffect.Delete()
-	a.rollEffect.Delete()
+	a.subs.Release()
+	a.music.Delete()
+	for _, sound := range a.sounds {
+		sound.Delete()
+	}
 }
 
 func NewAudioSystem(app *Application) (audioSystem *AudioSystem, err error) {
 	var (
-		bgm               *twodee.Music
-		bossMusic         *twodee.Music
-		bossDeathEffect   *twodee.SoundEffect
-		colorChangeEffect *twodee.SoundEffect
-		playerDeathEffect *twodee.SoundEffect
-		rollEffect        *twodee.SoundEffect
+		musicConfig *MusicConfig
+		bank        SoundBank
 	)
-
-	if bgm, err = twodee.NewMusic("resources/music/Shrine_Theme_Rough.ogg"); err != nil {
+	if musicConfig, err = LoadMusicConfig(MusicConfigPath); err != nil {
 		return
 	}
-	if bossMusic, err = twodee.NewMusic("resources/music/Boss_Theme_Rough.ogg"); err != nil {
+	if bank, err = LoadSoundBank(SoundBankPath); err != nil {
 		return
 	}
-	if bossDeathEffect, err = twodee.NewSoundEffect("resources/music/BossDeathEffect.ogg"); err != nil {
-		return
-	}
-	if colorChangeEffect, err = twodee.NewSoundEffect("resources/music/ColorChangeEffect.ogg"); err != nil {
-		return
-	}
-	if playerDeathEffect, err = twodee.NewSoundEffect("resources/music/PlayerDeath.ogg"); err != nil {
-		return
+	audioSystem = &AudioSystem{
+		app:      app,
+		Mixer:    NewMixer(),
+		Channels: NewChannelPool(FirstEffectChannel, EffectChannels),
 	}
-	if rollEffect, err = twodee.NewSoundEffect("resources/music/RollEffect.ogg"); err != nil {
+	if audioSystem.music, err = NewMusicPlayer(musicConfig, audioSystem.Mixer, app.Settings.Music); err != nil {
 		return
 	}
-	audioSystem = &AudioSystem{
-		app:               app,
-		bgm:               bgm,
-		bossMusic:         bossMusic,
-		bossDeathEffect:   bossDeathEffect,
-		colorChangeEffect: colorChangeEffect,
-		playerDeathEffect: playerDeathEffect,
-		rollEffect:        rollEffect,
-		musicToggle:       1,
+	for _, name := range bank.Events() {
+		var (
+			t, _  = EventTypeByName(name)
+			sound *Sound
+		)
+		if sound, err = NewSound(bank[name], audioSystem.Mixer); err != nil {
+			return
+		}
+		audioSystem.addSound(t, sound)
 	}
-	playerDeathEffect.SetVolume(50)
-	audioSystem.bgmObserverId = app.GameEventHandler.AddObserver(PlayBackgroundMusic, audioSystem.PlayBackgroundMusic)
-	audioSystem.bgmObserverId = app.GameEventHandler.AddObserver(PlayBossMusic, audioSystem.PlayBossMusic)
-	audioSystem.pauseMusicObserverId = app.GameEventHandler.AddObserver(PauseMusic, audioSystem.PauseMusic)
-	audioSystem.resumeMusicObserverId = app.GameEventHandler.AddObserver(ResumeMusic, audioSystem.ResumeMusic)
-	audioSystem.bossDeathEffectObserverId = app.GameEventHandler.AddObserver(PlayBossDeathEffect, audioSystem.PlayBossDeathEffect)
-	audioSystem.colorChangeEffectObserverId = app.GameEventHandler.AddObserver(PlayColorChangeEffect, audioSystem.PlayColorChangeEffect)
-	audioSystem.playerDeathEffectObserverId = app.GameEventHandler.AddObserver(PlayPlayerDeathEffect, audioSystem.PlayPlayerDeathEffect)
-	audioSystem.rollEffectObserverId = app.GameEventHandler.AddObserver(PlayRollEffect, audioSystem.PlayRollEffect)
+	audioSystem.SetVolumes(app.Settings.MasterVolume, app.Settings.MusicVolume, app.Settings.EffectsVolume)
+	audioSystem.subs.Add(
+		Subscribe(app.GameEventHandler, PlayMusic, audioSystem.PlayMusic),
+		Subscribe(app.GameEventHandler, PauseMusic, audioSystem.PauseMusic),
+		Subscribe(app.GameEventHandler, ResumeMusic, audioSystem.ResumeMusic),
+	)
 	return
 }
@@ -18,6 +18,7 @@ import (
 	"../lib/twodee"
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
+	"math"
 	"time"
 )
 
@@ -39,36 +40,121 @@ var BossMap = map[string]BossMaker{
 	"boss2": MakeBoss2,
 }
 
-type BossMaker func(x, y float32, events *twodee.GameEventHandler) *Boss
+type BossMaker func(x, y float32, events *EventBus) *Boss
+
+// BossPhase describes how a boss behaves while it displays a given color.
+// Each color the player peels off advances the boss to its next phase.
+type BossPhase struct {
+	Color           mgl32.Vec3
+	Speed           float32
+	DetectionRadius float32
+	BoredThreshold  time.Duration
+	States          MobStateMask
+	SearchPattern   []mgl32.Vec2
+	// LookAround is how long the boss searches the spot where it last saw
+	// or heard the player before giving up.
+	LookAround time.Duration
+	// FireRate is the time between color bolts fired at the player while
+	// hunting. Zero means the boss doesn't shoot.
+	FireRate time.Duration
+	// Stagger is how long the boss stands still and ignores the player when
+	// entering this phase. Ignored for the first phase.
+	Stagger time.Duration
+}
 
 // MakeBoss1 returns a boss that searches left and right and gets bored easily.
-func MakeBoss1(x, y float32, events *twodee.GameEventHandler) *Boss {
-	sp := []mgl32.Vec2{
-		mgl32.Vec2{x - 4, y},
-		mgl32.Vec2{x + 4, y},
-	}
-	return NewBoss("boss1", &Mobile{
-		DetectionRadius: 10,
-		BoredThreshold:  5 * time.Second,
-		speed:           0.06,
-		searchPattern:   sp,
-	}, []mgl32.Vec3{
-		mgl32.Vec3{1.0, 0.0, 0.0},
-		mgl32.Vec3{0.0, 1.0, 0.0},
-		mgl32.Vec3{0.0, 0.0, 1.0},
+// Each phase widens its patrol and makes it quicker to notice the player.
+func MakeBoss1(x, y float32, events *EventBus) *Boss {
+	return NewBoss("boss1", []BossPhase{
+		BossPhase{
+			Color:           mgl32.Vec3{1.0, 0.0, 0.0},
+			Speed:           0.06,
+			DetectionRadius: 10,
+			BoredThreshold:  5 * time.Second,
+			LookAround:      2 * time.Second,
+			States:          SearchAllowed | HuntAllowed | InvestigateAllowed,
+			SearchPattern: []mgl32.Vec2{
+				mgl32.Vec2{x - 4, y},
+				mgl32.Vec2{x + 4, y},
+			},
+		},
+		BossPhase{
+			Color:           mgl32.Vec3{0.0, 1.0, 0.0},
+			Speed:           0.07,
+			DetectionRadius: 12,
+			BoredThreshold:  7 * time.Second,
+			LookAround:      3 * time.Second,
+			States:          SearchAllowed | HuntAllowed | InvestigateAllowed,
+			SearchPattern: []mgl32.Vec2{
+				mgl32.Vec2{x - 6, y},
+				mgl32.Vec2{x, y + 3},
+				mgl32.Vec2{x + 6, y},
+				mgl32.Vec2{x, y - 3},
+			},
+			Stagger: 1 * time.Second,
+		},
+		BossPhase{
+			Color:           mgl32.Vec3{0.0, 0.0, 1.0},
+			Speed:           0.085,
+			DetectionRadius: 14,
+			BoredThreshold:  10 * time.Second,
+			LookAround:      4 * time.Second,
+			States:          SearchAllowed | HuntAllowed | InvestigateAllowed,
+			SearchPattern: []mgl32.Vec2{
+				mgl32.Vec2{x - 8, y + 4},
+				mgl32.Vec2{x + 8, y + 4},
+				mgl32.Vec2{x + 8, y - 4},
+				mgl32.Vec2{x - 8, y - 4},
+			},
+			FireRate: 2 * time.Second,
+			Stagger:  1500 * time.Millisecond,
+		},
 	}, events)
 }
 
-func MakeBoss2(x, y float32, events *twodee.GameEventHandler) *Boss {
-	return NewBoss("boss2", &Mobile{
-		DetectionRadius: 10,
-		BoredThreshold:  20 * time.Second,
-		speed:           0.05,
-		searchPattern:   []mgl32.Vec2{},
-	}, []mgl32.Vec3{
-		mgl32.Vec3{0.0, 1.0, 1.0},
-		mgl32.Vec3{1.0, 1.0, 0.0},
-		mgl32.Vec3{1.0, 0.5, 1.0},
+// MakeBoss2 returns a boss that waits in place until it sees the player.
+// Once hurt it starts patrolling the arena and holds a grudge for longer.
+func MakeBoss2(x, y float32, events *EventBus) *Boss {
+	return NewBoss("boss2", []BossPhase{
+		BossPhase{
+			Color:           mgl32.Vec3{0.0, 1.0, 1.0},
+			Speed:           0.05,
+			DetectionRadius: 10,
+			BoredThreshold:  20 * time.Second,
+			LookAround:      3 * time.Second,
+			States:          SearchAllowed | HuntAllowed | InvestigateAllowed,
+			SearchPattern:   []mgl32.Vec2{},
+		},
+		BossPhase{
+			Color:           mgl32.Vec3{1.0, 1.0, 0.0},
+			Speed:           0.06,
+			DetectionRadius: 12,
+			BoredThreshold:  25 * time.Second,
+			LookAround:      4 * time.Second,
+			States:          SearchAllowed | HuntAllowed | InvestigateAllowed,
+			SearchPattern: []mgl32.Vec2{
+				mgl32.Vec2{x, y + 5},
+				mgl32.Vec2{x, y - 5},
+			},
+			FireRate: 3 * time.Second,
+			Stagger:  1 * time.Second,
+		},
+		BossPhase{
+			Color:           mgl32.Vec3{1.0, 0.5, 1.0},
+			Speed:           0.075,
+			DetectionRadius: 16,
+			BoredThreshold:  30 * time.Second,
+			LookAround:      5 * time.Second,
+			States:          SearchAllowed | HuntAllowed | InvestigateAllowed,
+			SearchPattern: []mgl32.Vec2{
+				mgl32.Vec2{x - 6, y + 5},
+				mgl32.Vec2{x + 6, y + 5},
+				mgl32.Vec2{x + 6, y - 5},
+				mgl32.Vec2{x - 6, y - 5},
+			},
+			FireRate: 2 * time.Second,
+			Stagger:  1500 * time.Millisecond,
+		},
 	}, events)
 }
 
@@ -79,25 +165,32 @@ type Boss struct {
 	dx, dy, speed float32
 	StateStack    []MobState
 	Color         mgl32.Vec3
-	Colors        []mgl32.Vec3
-	events        *twodee.GameEventHandler
+	Colors        []BossPhase
+	Phase         int
+	phase         BossPhase
+	fireRate      time.Duration
+	sinceFired    time.Duration
+	events        *EventBus
 	Dead          bool
 	Name          string
+	// stride is how far the boss has walked since its last footstep.
+	stride float32
 }
 
-func NewBoss(name string, m *Mobile, colors []mgl32.Vec3, events *twodee.GameEventHandler) *Boss {
+func NewBoss(name string, phases []BossPhase, events *EventBus) *Boss {
 	b := &Boss{
 		AnimatingEntity: twodee.NewAnimatingEntity(
 			0, 0, 1, 1, 0,
 			twodee.Step5Hz,
 			BossAnimations[Normal],
 		),
-		Mobile:     m,
+		Mobile:     &Mobile{},
 		dx:         0.0,
 		dy:         0.0,
 		speed:      0.04,
 		StateStack: []MobState{NewVegState()},
-		Colors:     colors,
+		Colors:     phases,
+		Phase:      -1,
 		events:     events,
 		Dead:       false,
 		Name:       name,
@@ -106,16 +199,79 @@ func NewBoss(name string, m *Mobile, colors []mgl32.Vec3, events *twodee.GameEve
 	return b
 }
 
+// NextColor advances the boss to its next phase, or kills it if no phases
+// remain. Every phase after the first starts with a stagger.
 func (b *Boss) NextColor() {
 	if len(b.Colors) > 0 {
-		b.Color = b.Colors[0]
+		phase := b.Colors[0]
 		b.Colors = b.Colors[1:]
+		b.Phase++
+		b.setPhase(phase)
 		b.events.Enqueue(NewBossColorEvent(b.Color))
+		if b.Phase > 0 {
+			b.events.Enqueue(NewBossPhaseChangeEvent(b.Name, b.Phase, phase.Stagger))
+		}
 	} else {
 		b.events.Enqueue(NewBossDiedEvent(b.Name))
 	}
 }
 
+func (b *Boss) setPhase(phase BossPhase) {
+	b.usePhase(phase)
+	b.sinceFired = 0
+	if b.Phase == 0 {
+		return
+	}
+	// Start the new phase from scratch so that search states pick up the
+	// new pattern once the stagger wears off.
+	b.StateStack[len(b.StateStack)-1].Exit(b)
+	b.StateStack = []MobState{NewVegState()}
+	if phase.Stagger > 0 {
+		b.StateStack = append(b.StateStack, NewStaggerState(phase.Stagger))
+	}
+	b.StateStack[len(b.StateStack)-1].Enter(b)
+}
+
+// usePhase takes on the color and behaviour of phase.
+func (b *Boss) usePhase(phase BossPhase) {
+	b.phase = phase
+	b.Color = phase.Color
+	b.Mobile.speed = phase.Speed
+	b.Mobile.DetectionRadius = phase.DetectionRadius
+	b.Mobile.BoredThreshold = phase.BoredThreshold
+	b.Mobile.States = phase.States
+	b.Mobile.searchPattern = phase.SearchPattern
+	b.Mobile.lookAround = phase.LookAround
+	b.fireRate = phase.FireRate
+}
+
+// ApplyCharge strips the color of a thrown charge from the boss's current
+// color. Returns true if the charge had any effect. A boss stripped of its
+// color entirely moves on to its next phase.
+func (b *Boss) ApplyCharge(charge mgl32.Vec3) bool {
+	var remaining mgl32.Vec3
+	for i := range remaining {
+		remaining[i] = float32(math.Max(float64(b.Color[i]-charge[i]), 0.0))
+	}
+	if remaining == b.Color {
+		return false
+	}
+	if remaining.Len() < 0.1 {
+		b.NextColor()
+	} else {
+		b.Color = remaining
+		b.events.Enqueue(NewBossColorEvent(b.Color))
+	}
+	return true
+}
+
+// Invulnerable returns true while the boss is staggered between phases. It
+// can neither hurt the player nor lose another color during this time.
+func (b *Boss) Invulnerable() bool {
+	_, ok := b.StateStack[len(b.StateStack)-1].(*StaggerState)
+	return ok
+}
+
 func (b *Boss) ExamineWorld(l *Level) {
 	cState := b.StateStack[len(b.StateStack)-1]
 	newState := cState.ExamineWorld(b, l)
@@ -126,6 +282,11 @@ func (b *Boss) ExamineWorld(l *Level) {
 		cState.Exit(b)
 		b.StateStack = b.StateStack[:len(b.StateStack)-1]
 		b.StateStack[len(b.StateStack)-1].Enter(b)
+		if _, ok := cState.(*StaggerState); ok {
+			// The level may have matched the next color while the
+			// boss couldn't be hurt.
+			l.matchBossColor()
+		}
 		return
 	}
 	cState.Exit(b)
@@ -136,11 +297,28 @@ func (b *Boss) ExamineWorld(l *Level) {
 func (b *Boss) Update(elapsed time.Duration) {
 	b.AnimatingEntity.Update(elapsed)
 	if !b.Dead {
+		var (
+			from = b.Pos()
+		)
+		b.sinceFired += elapsed
 		// Hrm, should update be fed to every state in the stack?
 		for i := len(b.StateStack) - 1; i >= 0; i-- {
 			b.StateStack[i].Update(b, elapsed)
 		}
 		//	b.StateStack[len(b.StateStack)-1].Update(b, elapsed)
+		b.updateFootsteps(b.Pos().Sub(from.Vec2).Len())
+	}
+}
+
+// BossStride is how far the boss walks between footsteps.
+const BossStride = 1.5
+
+// updateFootsteps plays a footstep where the boss is every BossStride it
+// walks.
+func (b *Boss) updateFootsteps(moved float32) {
+	if b.stride += moved; b.stride >= BossStride {
+		b.stride -= BossStride
+		b.events.Enqueue(NewSoundEvent(BossStep, b.Pos()))
 	}
 }
 
@@ -160,6 +338,10 @@ func (b *Boss) SpriteConfig(sheet *twodee.Spritesheet) twodee.SpriteConfig {
 	frame := sheet.GetFrame(fmt.Sprintf("boss_%02d", b.Frame()))
 	pt := b.Pos()
 	scaleX := float32(1.0)
+	color := b.Color.Vec4(1.0)
+	if b.Invulnerable() && b.Frame()%2 == 0 {
+		color = mgl32.Vec4{1.0, 1.0, 1.0, 1.0}
+	}
 	// Implement facing left...
 	return twodee.SpriteConfig{
 		View: twodee.ModelViewConfig{
@@ -168,7 +350,39 @@ func (b *Boss) SpriteConfig(sheet *twodee.Spritesheet) twodee.SpriteConfig {
 			scaleX, 1.0, 1.0,
 		},
 		Frame: frame.Frame,
-		Color: b.Color.Vec4(1.0),
+		Color: color,
+	}
+}
+
+const (
+	// BoltSpeed is how far a boss's color bolt travels each update.
+	BoltSpeed = 0.12
+	// BoltLifetime is how long a color bolt flies before fizzling out.
+	BoltLifetime = 3 * time.Second
+)
+
+// Fire returns a bolt of the boss's current color aimed at target, or nil if
+// the boss doesn't shoot or is still reloading.
+func (b *Boss) Fire(target mgl32.Vec2) *Projectile {
+	if b.fireRate <= 0 || b.sinceFired < b.fireRate {
+		return nil
+	}
+	b.sinceFired = 0
+	pos := b.Pos().Vec2
+	return NewProjectile(
+		pos,
+		target.Sub(pos).Normalize().Mul(BoltSpeed),
+		BoltLifetime,
+		b.Color,
+		BossProjectile,
+		b.boltHit,
+	)
+}
+
+// boltHit kills the player if they are hit by one of the boss's bolts.
+func (b *Boss) boltHit(p *Projectile, target Prop) {
+	if _, ok := target.(*Player); ok {
+		b.events.Enqueue(NewPlayerDiedEvent())
 	}
 }
 
@@ -176,3 +390,72 @@ func (b *Boss) ShouldSwing(p mgl32.Vec2) bool {
 	bv := mgl32.Vec2{b.Pos().X(), b.Pos().Y()}
 	return p.Sub(bv).Len() < 1
 }
+
+// BossSnapshot is everything about a boss that changes during a fight.
+type BossSnapshot struct {
+	Pos        mgl32.Vec2      `json:"pos"`
+	Color      mgl32.Vec3      `json:"color"`
+	Phase      int             `json:"phase"`
+	Current    BossPhase       `json:"current"`
+	Colors     []BossPhase     `json:"colors"`
+	SinceFired time.Duration   `json:"since_fired"`
+	States     []SavedMobState `json:"states"`
+	// stack is used instead of States by snapshots which are never written.
+	stack []MobState
+}
+
+// Snapshot captures the boss mid-fight. Dead bosses can't be captured.
+func (b *Boss) Snapshot() (s *BossSnapshot, err error) {
+	return b.snapshot(false)
+}
+
+// snapshot captures the boss, copying its states rather than saving them if
+// the snapshot will only be kept in memory.
+func (b *Boss) snapshot(inMemory bool) (s *BossSnapshot, err error) {
+	if b.Dead {
+		return nil, fmt.Errorf("Boss %v is dead", b.Name)
+	}
+	s = &BossSnapshot{
+		Pos:        b.Pos().Vec2,
+		Color:      b.Color,
+		Phase:      b.Phase,
+		Current:    b.phase,
+		Colors:     b.Colors, // Phases are never changed in place.
+		SinceFired: b.sinceFired,
+	}
+	if inMemory {
+		s.stack, err = CopyMobStates(b.StateStack)
+	} else {
+		s.States, err = SaveMobStates(b.StateStack)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Restore puts the boss back the way it was when s was captured.
+func (b *Boss) Restore(s *BossSnapshot) (err error) {
+	var (
+		stack []MobState
+	)
+	if s.stack != nil {
+		stack, err = CopyMobStates(s.stack)
+	} else {
+		stack, err = LoadMobStates(s.States)
+	}
+	if err != nil {
+		return
+	}
+	if len(stack) == 0 {
+		return fmt.Errorf("Boss %v has no states", b.Name)
+	}
+	b.MoveTo(twodee.Pt(s.Pos[0], s.Pos[1]))
+	b.Phase = s.Phase
+	b.usePhase(s.Current)
+	b.Color = s.Color
+	b.Colors = append([]BossPhase{}, s.Colors...)
+	b.sinceFired = s.SinceFired
+	b.StateStack = stack
+	return
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"./sdlmixer"
+	"fmt"
+	"time"
+)
+
+const (
+	// EffectChannels is how many mixer channels sound effects share.
+	// Channels before FirstEffectChannel play the music.
+	EffectChannels = 6
+)
+
+// voice is a sound playing on a channel.
+type voice struct {
+	sound    *Sound
+	priority int
+	started  time.Duration
+}
+
+// playing returns true if the voice's channel is still busy.
+func (v *voice) playing(channel int) bool {
+	return v.sound != nil && sdlmixer.Playing(channel)
+}
+
+// ChannelPool hands out mixer channels to sound effects. When every channel
+// is busy a new sound takes the channel of the oldest, lowest priority sound
+// playing, as long as that's no higher priority than itself. Otherwise the
+// new sound is dropped. Counters are kept for the debug overlay.
+type ChannelPool struct {
+	Played  int
+	Dropped int
+	Stolen  int
+	first   int
+	voices  []voice
+}
+
+func NewChannelPool(first, channels int) *ChannelPool {
+	return &ChannelPool{
+		first:  first,
+		voices: make([]voice, channels),
+	}
+}
+
+// Claim returns a free or stolen channel to play sound on, or -1
+// if sound already has its maximum number of voices playing or no channel
+// can be had. now is the audio system's clock.
+func (p *ChannelPool) Claim(sound *Sound, now time.Duration) int {
+	var (
+		free     = -1
+		steal    = -1
+		voices   = 0
+		priority = sound.Entry.Priority
+	)
+	for i := range p.voices {
+		v := &p.voices[i]
+		if !v.playing(p.first + i) {
+			v.sound = nil
+			if free < 0 {
+				free = i
+			}
+			continue
+		}
+		if v.sound == sound {
+			voices++
+		}
+		if v.priority > priority {
+			continue
+		}
+		if steal < 0 || v.priority < p.voices[steal].priority ||
+			(v.priority == p.voices[steal].priority && v.started < p.voices[steal].started) {
+			steal = i
+		}
+	}
+	switch {
+	case voices >= sound.Entry.MaxVoices():
+		p.Dropped++
+		return -1
+	case free >= 0:
+	case steal >= 0:
+		free = steal
+		p.Stolen++
+	default:
+		p.Dropped++
+		return -1
+	}
+	p.voices[free] = voice{sound, priority, now}
+	p.Played++
+	return p.first + free
+}
+
+// Busy returns how many channels are playing.
+func (p *ChannelPool) Busy() (n int) {
+	for i := range p.voices {
+		if p.voices[i].playing(p.first + i) {
+			n++
+		}
+	}
+	return
+}
+
+func (p *ChannelPool) String() string {
+	return fmt.Sprintf("Channels %v/%v played %v dropped %v stolen %v",
+		p.Busy(), len(p.voices), p.Played, p.Dropped, p.Stolen)
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+)
+
+// EventBus queues game events and dispatches them to observers. Events
+// which affect the simulation are dispatched between updates, so that they're
+// handled in step with the simulation no matter how many updates run per
+// frame. Events which only affect what's shown or heard are dispatched once
+// per frame. Everything passing through the bus can be traced.
+type EventBus struct {
+	Trace *EventTrace
+	// sim and render hold the observers. Events are queued here rather
+	// than in them so that a traced dispatch is recorded before any
+	// observer sees the event.
+	sim         *twodee.GameEventHandler
+	render      *twodee.GameEventHandler
+	simQueue    []twodee.GETyper
+	renderQueue []twodee.GETyper
+	isRender    func(twodee.GameEventType) bool
+}
+
+// NewEventBus creates a bus for numTypes event types. isRender picks out the
+// types which only affect presentation.
+func NewEventBus(numTypes int, isRender func(twodee.GameEventType) bool) *EventBus {
+	return &EventBus{
+		sim:      twodee.NewGameEventHandler(numTypes),
+		render:   twodee.NewGameEventHandler(numTypes),
+		isRender: isRender,
+	}
+}
+
+func (b *EventBus) handler(t twodee.GameEventType) *twodee.GameEventHandler {
+	if b.isRender(t) {
+		return b.render
+	}
+	return b.sim
+}
+
+func (b *EventBus) AddObserver(t twodee.GameEventType, f twodee.GameEventTypeObserver) int {
+	return b.handler(t).AddObserver(t, f)
+}
+
+func (b *EventBus) RemoveObserver(t twodee.GameEventType, id int) {
+	b.handler(t).RemoveObserver(t, id)
+}
+
+// Enqueue queues an event for the next PollSim, or the next PollRender if it
+// only affects presentation.
+func (b *EventBus) Enqueue(e twodee.GETyper) {
+	if b.Trace != nil {
+		b.Trace.Record(TraceEnqueued, e)
+	}
+	if b.isRender(e.GEType()) {
+		b.renderQueue = append(b.renderQueue, e)
+	} else {
+		b.simQueue = append(b.simQueue, e)
+	}
+}
+
+// PollSim dispatches queued simulation events. Call before every update.
+func (b *EventBus) PollSim() {
+	b.poll(b.sim, &b.simQueue)
+}
+
+// PollRender dispatches queued presentation events. Call once per frame.
+func (b *EventBus) PollRender() {
+	b.poll(b.render, &b.renderQueue)
+}
+
+// poll dispatches the events in queue one at a time, in the order they
+// were queued, including any queued by observers along the way.
+func (b *EventBus) poll(h *twodee.GameEventHandler, queue *[]twodee.GETyper) {
+	for len(*queue) > 0 {
+		e := (*queue)[0]
+		*queue = (*queue)[1:]
+		if b.Trace != nil {
+			b.Trace.Record(TraceDispatched, e)
+		}
+		h.Enqueue(e)
+		h.Poll()
+	}
+}
+
+// StartTrace records every event enqueued on or dispatched by the bus to t
+// until StopTrace is called.
+func (b *EventBus) StartTrace(t *EventTrace) {
+	b.StopTrace()
+	b.Trace = t
+}
+
+// StopTrace stops recording and closes the trace, if there is one.
+func (b *EventBus) StopTrace() (err error) {
+	if b.Trace != nil {
+		err = b.Trace.Close()
+		b.Trace = nil
+	}
+	return
+}
+
+// Subscription is a handle to an observer added with Subscribe.
+type Subscription struct {
+	events *EventBus
+	t      twodee.GameEventType
+	id     int
+}
+
+// Subscribe calls f with every event of type t. Events are passed as T, so
+// handlers take their concrete event type. Events of type t which are not a T
+// are dropped.
+func Subscribe[T twodee.GETyper](events *EventBus, t twodee.GameEventType, f func(T)) *Subscription {
+	id := events.AddObserver(t, func(e twodee.GETyper) {
+		if event, ok := e.(T); ok {
+			f(event)
+		}
+	})
+	return &Subscription{
+		events: events,
+		t:      t,
+		id:     id,
+	}
+}
+
+// Unsubscribe removes the observer. It's safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	if s == nil || s.events == nil {
+		return
+	}
+	s.events.RemoveObserver(s.t, s.id)
+	s.events = nil
+}
+
+// Subscriptions is a group of subscriptions which are released together by
+// whatever owns them.
+type Subscriptions []*Subscription
+
+// Add adds subscriptions to the group.
+func (g *Subscriptions) Add(subs ...*Subscription) {
+	*g = append(*g, subs...)
+}
+
+// Release unsubscribes everything in the group and empties it.
+func (g *Subscriptions) Release() {
+	for _, s := range *g {
+		s.Unsubscribe()
+	}
+	*g = (*g)[:0]
+}
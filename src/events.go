@@ -16,12 +16,13 @@ package main
 
 import (
 	"../lib/twodee"
+	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
+	"time"
 )
 
 const (
-	PlayBackgroundMusic twodee.GameEventType = iota
-	PlayBossMusic
+	PlayMusic twodee.GameEventType = iota
 	PauseMusic
 	ResumeMusic
 	PlayBossDeathEffect
@@ -31,8 +32,15 @@ const (
 	ShakeCamera
 	ChangeColor
 	BossColor
+	BossPhaseChange
 	BossDied
 	PlayerDied
+	Noise
+	NewGame
+	ContinueGame
+	GameWon
+	AchievementUnlocked
+	BossStep
 	SENTINEL
 )
 
@@ -40,6 +48,59 @@ const (
 	NumGameEventTypes = int(SENTINEL)
 )
 
+var eventTypeNames = [NumGameEventTypes]string{
+	"PlayMusic",
+	"PauseMusic",
+	"ResumeMusic",
+	"PlayBossDeathEffect",
+	"PlayColorChangeEffect",
+	"PlayPlayerDeathEffect",
+	"PlayRollEffect",
+	"ShakeCamera",
+	"ChangeColor",
+	"BossColor",
+	"BossPhaseChange",
+	"BossDied",
+	"PlayerDied",
+	"Noise",
+	"NewGame",
+	"ContinueGame",
+	"GameWon",
+	"AchievementUnlocked",
+	"BossStep",
+}
+
+// IsRenderEvent returns true for event types which only change what's shown
+// or heard. These never feed back into the simulation, so they're dispatched
+// once per frame rather than between updates.
+func IsRenderEvent(t twodee.GameEventType) bool {
+	switch t {
+	case PlayMusic, PauseMusic, ResumeMusic,
+		PlayBossDeathEffect, PlayColorChangeEffect, PlayPlayerDeathEffect,
+		PlayRollEffect, ShakeCamera, AchievementUnlocked, BossStep:
+		return true
+	}
+	return false
+}
+
+// EventTypeName returns a readable name for an event type.
+func EventTypeName(t twodee.GameEventType) string {
+	if t < 0 || int(t) >= NumGameEventTypes {
+		return fmt.Sprintf("Unknown(%v)", int(t))
+	}
+	return eventTypeNames[t]
+}
+
+// EventTypeByName looks up an event type by its readable name.
+func EventTypeByName(name string) (twodee.GameEventType, bool) {
+	for i, n := range eventTypeNames {
+		if n == name {
+			return twodee.GameEventType(i), true
+		}
+	}
+	return 0, false
+}
+
 type ColorEvent struct {
 	twodee.BasicGameEvent
 	Color mgl32.Vec3
@@ -54,6 +115,45 @@ func NewColorEvent(color mgl32.Vec3, add bool) *ColorEvent {
 	}
 }
 
+// SoundEvent plays the sound for its type as though it came from Pos.
+type SoundEvent struct {
+	twodee.BasicGameEvent
+	Pos twodee.Point
+}
+
+func NewSoundEvent(t twodee.GameEventType, pos twodee.Point) *SoundEvent {
+	return &SoundEvent{
+		*twodee.NewBasicGameEvent(t),
+		pos,
+	}
+}
+
+// MusicEvent plays the music for a level.
+type MusicEvent struct {
+	twodee.BasicGameEvent
+	Level string
+}
+
+func NewMusicEvent(level string) *MusicEvent {
+	return &MusicEvent{
+		*twodee.NewBasicGameEvent(PlayMusic),
+		level,
+	}
+}
+
+// SlotEvent starts or continues a game in a save slot.
+type SlotEvent struct {
+	twodee.BasicGameEvent
+	Slot int
+}
+
+func NewSlotEvent(t twodee.GameEventType, slot int) *SlotEvent {
+	return &SlotEvent{
+		BasicGameEvent: *twodee.NewBasicGameEvent(t),
+		Slot:           slot,
+	}
+}
+
 type ShakeEvent struct {
 	twodee.BasicGameEvent
 	Millis    int32
@@ -86,6 +186,22 @@ func NewBossColorEvent(color mgl32.Vec3) *BossColorEvent {
 	}
 }
 
+type BossPhaseChangeEvent struct {
+	twodee.BasicGameEvent
+	Name    string
+	Phase   int
+	Stagger time.Duration
+}
+
+func NewBossPhaseChangeEvent(name string, phase int, stagger time.Duration) *BossPhaseChangeEvent {
+	return &BossPhaseChangeEvent{
+		BasicGameEvent: *twodee.NewBasicGameEvent(BossPhaseChange),
+		Name:           name,
+		Phase:          phase,
+		Stagger:        stagger,
+	}
+}
+
 type BossDiedEvent struct {
 	twodee.BasicGameEvent
 	Name string
@@ -107,3 +223,33 @@ func NewPlayerDiedEvent() *PlayerDiedEvent {
 		*twodee.NewBasicGameEvent(PlayerDied),
 	}
 }
+
+// NoiseEvent is emitted by loud actions. Mobs within Radius of Pos hear it.
+type NoiseEvent struct {
+	twodee.BasicGameEvent
+	Pos    twodee.Point
+	Radius float32
+}
+
+func NewNoiseEvent(pos twodee.Point, radius float32) *NoiseEvent {
+	return &NoiseEvent{
+		BasicGameEvent: *twodee.NewBasicGameEvent(Noise),
+		Pos:            pos,
+		Radius:         radius,
+	}
+}
+
+// AchievementEvent announces a newly unlocked achievement.
+type AchievementEvent struct {
+	twodee.BasicGameEvent
+	ID   string
+	Name string
+}
+
+func NewAchievementEvent(id, name string) *AchievementEvent {
+	return &AchievementEvent{
+		BasicGameEvent: *twodee.NewBasicGameEvent(AchievementUnlocked),
+		ID:             id,
+		Name:           name,
+	}
+}
@@ -18,37 +18,61 @@ import (
 	"../lib/twodee"
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
-	"image/color"
 	"io/ioutil"
 	"math"
 	"time"
 )
 
+// RequiredBosses must all be killed to win.
+var RequiredBosses = []string{"boss1", "boss2"}
+
 const (
 	PxPerUnit = 32
+	// AttractDelay is how long the title screen waits before playing the
+	// demo.
+	AttractDelay = 20 * time.Second
+	// AttractReplay is the demo played on the title screen.
+	AttractReplay = "resources/demo.replay"
 )
 
 type GameLayer struct {
-	levels               map[string]string
-	shake                *twodee.ContinuousAnimation
-	cameraBounds         twodee.Rectangle
-	camera               *twodee.Camera
-	linesCamera          *twodee.Camera
-	sprite               *twodee.SpriteRenderer
-	lines                *twodee.LinesRenderer
-	debugLines           *twodee.LinesRenderer
-	batch                *twodee.BatchRenderer
-	effects              *EffectsRenderer
-	app                  *Application
-	spritesheet          *twodee.Spritesheet
-	spritetexture        *twodee.Texture
-	level                *Level
-	hud                  *Hud
-	splash               string
-	shakeObserverId      int
-	shakePriority        int32
-	bossDiedObserverId   int
-	playerDiedObserverId int
+	levels        map[string]string
+	shake         *twodee.ContinuousAnimation
+	cameraBounds  twodee.Rectangle
+	camera        *twodee.Camera
+	linesCamera   *twodee.Camera
+	sprite        *twodee.SpriteRenderer
+	lines         *twodee.LinesRenderer
+	debugLines    *twodee.LinesRenderer
+	batch         *twodee.BatchRenderer
+	effects       *EffectsRenderer
+	app           *Application
+	spritesheet   *twodee.Spritesheet
+	spritetexture *twodee.Texture
+	level         *Level
+	hud           *Hud
+	aiDebug       *AIDebug
+	rewindHud     *RewindHud
+	rewind        *Rewind
+	rewinding     bool
+	deathOffer    time.Duration
+	quickSave     bool
+	quickLoad     bool
+	splash        string
+	subs          Subscriptions
+	shakePriority int32
+	bossFocus     time.Duration
+	pressed       InputButtons
+	joyHeld       InputButtons
+	recording     *Replay
+	playback      *Replay
+	playbackFrame int
+	resume        *Replay
+	resumeAt      *LevelSnapshot
+	attract       bool
+	idle          time.Duration
+	prevCamera    twodee.Rectangle
+	lastReplay    string
 }
 
 func NewGameLayer(winb twodee.Rectangle, app *Application) (layer *GameLayer, err error) {
@@ -57,6 +81,8 @@ func NewGameLayer(winb twodee.Rectangle, app *Application) (layer *GameLayer, er
 		linesCamera  *twodee.Camera
 		cameraBounds = twodee.Rect(-8, -5, 8, 5)
 		hud          *Hud
+		aiDebug      *AIDebug
+		rewindHud    *RewindHud
 	)
 	if camera, err = twodee.NewCamera(cameraBounds, winb); err != nil {
 		return
@@ -67,6 +93,12 @@ func NewGameLayer(winb twodee.Rectangle, app *Application) (layer *GameLayer, er
 	if hud, err = newHud(); err != nil {
 		return
 	}
+	if aiDebug, err = NewAIDebug(winb); err != nil {
+		return
+	}
+	if rewindHud, err = NewRewindHud(winb); err != nil {
+		return
+	}
 	layer = &GameLayer{
 		camera:       camera,
 		linesCamera:  linesCamera,
@@ -79,6 +111,9 @@ func NewGameLayer(winb twodee.Rectangle, app *Application) (layer *GameLayer, er
 		},
 		shakePriority: -1,
 		hud:           hud,
+		aiDebug:       aiDebug,
+		rewindHud:     rewindHud,
+		rewind:        NewRewind(RewindSteps),
 		splash:        "splash",
 	}
 	err = layer.Reset()
@@ -102,22 +137,35 @@ func (l *GameLayer) Reset() (err error) {
 	if l.effects, err = NewEffectsRenderer(512, 320, 1.0); err != nil {
 		return
 	}
+	if err = l.aiDebug.Reset(); err != nil {
+		return
+	}
+	if err = l.rewindHud.Reset(); err != nil {
+		return
+	}
 	if err = l.loadSpritesheet(); err != nil {
 		return
 	}
-	l.shakeObserverId = l.app.GameEventHandler.AddObserver(ShakeCamera, l.shakeCamera)
-	l.bossDiedObserverId = l.app.GameEventHandler.AddObserver(BossDied, l.bossDied)
-	l.playerDiedObserverId = l.app.GameEventHandler.AddObserver(PlayerDied, l.playerDied)
+	l.subs.Add(
+		Subscribe(l.app.GameEventHandler, ShakeCamera, l.shakeCamera),
+		Subscribe(l.app.GameEventHandler, BossDied, l.bossDied),
+		Subscribe(l.app.GameEventHandler, PlayerDied, l.playerDied),
+		Subscribe(l.app.GameEventHandler, BossPhaseChange, l.bossPhaseChange),
+		Subscribe(l.app.GameEventHandler, NewGame, l.newGame),
+		Subscribe(l.app.GameEventHandler, ContinueGame, l.continueGame),
+	)
 	l.loadLevel("main")
-	l.app.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(PlayBackgroundMusic))
 	return
 }
 
 func (l *GameLayer) loadLevel(name string) (err error) {
 	var (
-		path string
-		ok   bool
+		path    string
+		ok      bool
+		started = time.Now()
 	)
+	// Loading doesn't count against a speedrun.
+	defer func() { l.app.Speedrun.Loaded(time.Since(started)) }()
 	if path, ok = l.levels[name]; !ok {
 		return fmt.Errorf("Invalid level: %v", name)
 	}
@@ -128,13 +176,17 @@ func (l *GameLayer) loadLevel(name string) (err error) {
 		return
 	}
 	l.updateCamera(1.0)
-	// check name of level being loaded
-	// if "main" then trigger PlayBackgroundMusic event
-	if name == "main" {
-		l.app.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(PlayBackgroundMusic))
+	l.prevCamera = l.camera.WorldBounds
+	l.rewinding = false
+	l.deathOffer = 0
+	l.app.Tracker.StartAttempt(name)
+	if l.level.Boss != nil {
+		l.rewind.Reset(RewindUses)
 	} else {
-		// else trigger PlayBossMusic event
-		l.app.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(PlayBossMusic))
+		l.rewind.Reset(0)
+	}
+	l.app.GameEventHandler.Enqueue(NewMusicEvent(name))
+	if name != "main" {
 		l.hud.UpdateLines(l.level, true)
 	}
 	return
@@ -165,15 +217,9 @@ func (l *GameLayer) Delete() {
 		l.effects.Delete()
 		l.effects = nil
 	}
-	if l.shakeObserverId != 0 {
-		l.app.GameEventHandler.RemoveObserver(ShakeCamera, l.shakeObserverId)
-	}
-	if l.bossDiedObserverId != 0 {
-		l.app.GameEventHandler.RemoveObserver(BossDied, l.bossDiedObserverId)
-	}
-	if l.playerDiedObserverId != 0 {
-		l.app.GameEventHandler.RemoveObserver(PlayerDied, l.playerDiedObserverId)
-	}
+	l.aiDebug.Delete()
+	l.rewindHud.Delete()
+	l.subs.Release()
 	if l.level != nil {
 		l.level.Delete()
 		l.level = nil
@@ -181,6 +227,18 @@ func (l *GameLayer) Delete() {
 }
 
 func (l *GameLayer) Render() {
+	// Draw from between the last two camera positions, to match the sprites.
+	var (
+		bounds = l.camera.WorldBounds
+		alpha  = l.app.Alpha
+	)
+	l.camera.SetWorldBounds(twodee.Rect(
+		l.prevCamera.Min.X()+(bounds.Min.X()-l.prevCamera.Min.X())*alpha,
+		l.prevCamera.Min.Y()+(bounds.Min.Y()-l.prevCamera.Min.Y())*alpha,
+		l.prevCamera.Max.X()+(bounds.Max.X()-l.prevCamera.Max.X())*alpha,
+		l.prevCamera.Max.Y()+(bounds.Max.Y()-l.prevCamera.Max.Y())*alpha,
+	))
+	defer l.camera.SetWorldBounds(bounds)
 	if l.splash != "" {
 		l.spritetexture.Bind()
 		splash := []twodee.SpriteConfig{l.getSplashSpriteConfig(l.splash, l.camera)}
@@ -207,7 +265,21 @@ func (l *GameLayer) Render() {
 				l.sprite.Draw(l.level.Plates.SpriteConfigs(l.spritesheet))
 			}
 			if len(l.level.Props) > 0 {
-				l.sprite.Draw(l.level.Props.SpriteConfigs(l.spritesheet))
+				configs := l.level.Props.SpriteConfigs(l.spritesheet)
+				for i, p := range l.level.Props {
+					configs[i] = l.level.Interpolate(p, configs[i], l.app.Alpha)
+					if p == l.level.Boss && l.app.Settings.Accessibility.ReduceFlashing {
+						configs[i].Color = l.level.Boss.Color.Vec4(1.0)
+					}
+				}
+				l.sprite.Draw(configs)
+			}
+			if len(l.level.Projectiles) > 0 {
+				configs := l.level.Projectiles.SpriteConfigs(l.spritesheet)
+				for i, p := range l.level.Projectiles {
+					configs[i] = l.level.Interpolate(p, configs[i], l.app.Alpha)
+				}
+				l.sprite.Draw(configs)
 			}
 			l.spritetexture.Unbind()
 			l.effects.Unbind()
@@ -227,52 +299,90 @@ func (l *GameLayer) Render() {
 			l.lines.Draw(l.hud.bossRedLine, modelview, l.hud.whiteStyle)
 			l.lines.Draw(l.hud.bossGreenLine, modelview, l.hud.whiteStyle)
 			l.lines.Draw(l.hud.bossBlueLine, modelview, l.hud.whiteStyle)
+			if l.level.Player.Charged {
+				l.lines.Draw(l.hud.chargeLine, modelview, l.hud.chargeStyle)
+			}
 			l.lines.Unbind()
 
+			l.drawAimLine()
 			if l.app.State.Debug {
-				l.drawBossLines()
+				l.aiDebug.Draw(l.level, l.debugLines)
+				l.aiDebug.DrawAudio(l.app.AudioSystem.Channels)
 			}
 		}
+		if label := l.rewindLabel(); label != "" {
+			l.rewindHud.Draw(label)
+		}
 	}
 }
 
-func (l *GameLayer) drawBossLines() {
-	if l.level.Boss == nil || len(l.level.BossPath) == 0 {
+// drawAimLine shows where a charge will be thrown while the player aims.
+func (l *GameLayer) drawAimLine() {
+	aiming, aim := l.level.Player.Aiming()
+	if !aiming || !l.level.Player.Charged {
 		return
 	}
 	var (
-		points = make([]mgl32.Vec2, len(l.level.BossPath))
-		geom   *twodee.LineGeometry
-		style  = &twodee.LineStyle{
-			Thickness: 0.15,
-			Color:     color.RGBA{255, 0, 255, 128},
+		pos    = l.level.Player.Pos().Vec2
+		points = []mgl32.Vec2{
+			pos.Add(aim.Mul(0.5)),
+			pos.Add(aim.Mul(3.0)),
 		}
-	)
-	for i, gridPoint := range l.level.BossPath {
-		points[i] = mgl32.Vec2{
-			l.level.BossCollisions.InversePosition(gridPoint.X, 0.5),
-			l.level.BossCollisions.InversePosition(gridPoint.Y, 0.5),
+		style = &twodee.LineStyle{
+			Thickness: 0.1,
+			Color:     l.hud.chargeStyle.Color,
 		}
-	}
-	geom = twodee.NewLineGeometry(points, false)
+	)
 	l.debugLines.Bind()
-	l.debugLines.Draw(geom, mgl32.Ident4(), style)
+	l.debugLines.Draw(twodee.NewLineGeometry(points, false), mgl32.Ident4(), style)
 	l.debugLines.Unbind()
 }
 
 func (l *GameLayer) Update(elapsed time.Duration) {
 	if l.splash != "" {
+		l.updateAttract(elapsed)
 		return
 	}
-	if !l.checkJoy() {
-		l.checkKeys()
+	var (
+		input InputFrame
+	)
+	// Sounds are heard from the simulation's camera, which is where
+	// anything making a sound this update sees it.
+	defer func() { l.app.AudioSystem.Listener.Bounds = l.camera.WorldBounds }()
+	if l.playback != nil {
+		if l.playbackFrame >= len(l.playback.Frames) {
+			l.StopPlayback()
+			return
+		}
+		input = l.playback.Frames[l.playbackFrame]
+		l.playbackFrame++
+	} else {
+		input = l.readInput()
+		if l.recording != nil {
+			l.recording.Frames = append(l.recording.Frames, input)
+		}
+	}
+	l.prevCamera = l.camera.WorldBounds
+	if l.playback == nil {
+		l.trackProgress(elapsed)
 	}
 	if l.shake != nil {
 		l.shake.Update(elapsed)
 	}
+	if l.bossFocus > 0 {
+		l.bossFocus -= elapsed
+	}
+	l.updateQuickSave()
+	if l.updateRewind(input, elapsed) {
+		l.updateCamera(0.05)
+		l.effects.Color = l.level.Color
+		return
+	}
+	input.Apply(l.level.Player)
 	l.updateCamera(0.05)
 	if l.level != nil {
 		l.level.Update(elapsed)
+		l.app.AudioSystem.Signal(l.musicSignals())
 		if collides, level := l.level.PortalCollides(); collides {
 			l.loadLevel(level)
 		}
@@ -280,6 +390,50 @@ func (l *GameLayer) Update(elapsed time.Duration) {
 	l.effects.Color = l.level.Color
 }
 
+// trackProgress counts playtime, overall and per level, and remembers where
+// the player is in the hub.
+func (l *GameLayer) trackProgress(elapsed time.Duration) {
+	var (
+		state = l.app.State
+	)
+	state.Playing = true
+	state.Playtime += elapsed
+	l.app.Tracker.Update(elapsed)
+	if l.level.Name == "main" && !l.level.Player.Dead {
+		pos := l.level.Player.Pos().Vec2
+		state.HubPosition = &pos
+	}
+}
+
+// newGame starts over in the hub, saving to the event's slot from now on.
+func (l *GameLayer) newGame(event *SlotEvent) {
+	l.StopRecording()
+	l.StopPlayback()
+	l.app.StartSlot(event.Slot)
+	l.app.State.Reset()
+	l.splash = ""
+	l.loadLevel("main")
+}
+
+// continueGame picks up from the progress saved in the event's slot, back
+// where the player last stood in the hub.
+func (l *GameLayer) continueGame(event *SlotEvent) {
+	if l.app.Saves[event.Slot] == nil {
+		return
+	}
+	l.StopRecording()
+	l.StopPlayback()
+	l.app.Slot = event.Slot
+	l.app.CurrentSave().Apply(l.app.State)
+	l.splash = ""
+	l.loadLevel("main")
+	if pos := l.app.State.HubPosition; pos != nil {
+		l.level.Player.MoveTo(twodee.Pt(pos[0], pos[1]))
+		l.updateCamera(1.0)
+		l.prevCamera = l.camera.WorldBounds
+	}
+}
+
 func (l *GameLayer) updateCamera(scale float32) {
 	if l.level.Player.Dead || (l.level.Boss != nil && l.level.Boss.Dead) {
 		return
@@ -297,6 +451,10 @@ func (l *GameLayer) updateCamera(scale float32) {
 		bounds  twodee.Rectangle
 		adj     mgl32.Vec2
 	)
+	if l.bossFocus > 0 && l.level.Boss != nil {
+		// Look at the boss while it staggers between phases.
+		diff = l.level.Boss.Pos().Vec2.Sub(cVec)
+	}
 	if diff.Len() > 1 {
 		adj = diff.Mul(scale)
 	} else {
@@ -314,73 +472,95 @@ func (l *GameLayer) updateCamera(scale float32) {
 	l.camera.SetWorldBounds(bounds)
 }
 
-func (l *GameLayer) shakeCamera(e twodee.GETyper) {
-	if event, ok := e.(*ShakeEvent); ok {
-		if l.shake == nil || event.Priority > l.shakePriority {
-			decay := twodee.SineDecayFunc(
-				time.Duration(event.Millis)*time.Millisecond,
-				event.Amplitude,
-				event.Frequency,
-				event.Decay,
-				func() {
-					l.shake = nil
-					l.shakePriority = -1
-				},
-			)
-			l.shake = twodee.NewContinuousAnimation(decay)
-			l.shakePriority = event.Priority
-		}
+func (l *GameLayer) shakeCamera(event *ShakeEvent) {
+	if !l.app.Settings.Accessibility.ScreenShake {
+		return
+	}
+	if l.shake == nil || event.Priority > l.shakePriority {
+		decay := twodee.SineDecayFunc(
+			time.Duration(event.Millis)*time.Millisecond,
+			event.Amplitude,
+			event.Frequency,
+			event.Decay,
+			func() {
+				l.shake = nil
+				l.shakePriority = -1
+			},
+		)
+		l.shake = twodee.NewContinuousAnimation(decay)
+		l.shakePriority = event.Priority
 	}
 }
 
-func (l *GameLayer) bossDied(e twodee.GETyper) {
-	if event, ok := e.(*BossDiedEvent); ok {
-		if l.level.Boss != nil && !l.level.Boss.Dead {
-			bounds := l.camera.WorldBounds
-			pt := l.level.Boss.Pos()
-			midpoint := bounds.Midpoint()
-			adjx := pt.X() - midpoint.X()
-			adjy := pt.Y() - midpoint.Y()
-			bounds.Min.Vec2[0] += adjx
-			bounds.Max.Vec2[0] += adjx
-			bounds.Min.Vec2[1] += adjy
-			bounds.Max.Vec2[1] += adjy
-			l.camera.SetWorldBounds(bounds)
-			l.level.Boss.Die()
-			l.level.Boss.SetCallback(func() {
-				l.checkBosses(event.Name)
-				l.loadLevel("main")
-			})
-		}
+func (l *GameLayer) bossDied(event *BossDiedEvent) {
+	if l.level.Boss != nil && !l.level.Boss.Dead {
+		bounds := l.camera.WorldBounds
+		pt := l.level.Boss.Pos()
+		midpoint := bounds.Midpoint()
+		adjx := pt.X() - midpoint.X()
+		adjy := pt.Y() - midpoint.Y()
+		bounds.Min.Vec2[0] += adjx
+		bounds.Max.Vec2[0] += adjx
+		bounds.Min.Vec2[1] += adjy
+		bounds.Max.Vec2[1] += adjy
+		l.camera.SetWorldBounds(bounds)
+		l.level.Boss.Die()
+		l.level.Boss.SetCallback(func() {
+			l.checkBosses(event.Name)
+			l.loadLevel("main")
+		})
+	}
+}
+
+func (l *GameLayer) bossPhaseChange(event *BossPhaseChangeEvent) {
+	l.bossFocus = event.Stagger
+	if l.app.State.Debug {
+		fmt.Printf("Boss %v entered phase %v\n", event.Name, event.Phase)
 	}
 }
 
 func (l *GameLayer) playerDied(e twodee.GETyper) {
+	if l.level.Player.Dead {
+		// Hit more than once before the first hit landed.
+		return
+	}
+	l.app.Tracker.Died()
 	if l.app.State.Debug {
 		fmt.Printf("Player died\n")
 	}
 	l.level.Player.Die()
 	l.level.Player.SetCallback(func() {
+		if l.deathOffer > 0 {
+			return
+		}
 		if l.app.State.Debug {
 			fmt.Printf("Done animating death\n")
 		}
+		if l.canRewind() {
+			// Give the player a chance to undo it before going back.
+			l.deathOffer = RewindOfferTime
+			return
+		}
 		l.loadLevel("main")
 	})
 }
 
 func (l *GameLayer) checkBosses(name string) {
 	var (
-		ok     bool
-		boss   string
-		needed = []string{"boss1", "boss2"}
+		ok   bool
+		boss string
 	)
 	l.app.State.KilledBosses[name] = true
-	for _, boss = range needed {
+	if l.playback == nil {
+		l.app.SaveProgress()
+	}
+	for _, boss = range RequiredBosses {
 		if _, ok = l.app.State.KilledBosses[boss]; !ok {
 			return
 		}
 	}
 	l.splash = "won"
+	l.app.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(GameWon))
 }
 
 func (l *GameLayer) HandleEvent(evt twodee.Event) bool {
@@ -399,20 +579,28 @@ func (l *GameLayer) HandleEvent(evt twodee.Event) bool {
 				l.app.State.Exit = true
 			}
 			l.splash = ""
+			l.idle = 0
+			return false
+		}
+		if l.playback != nil {
+			// Any key takes back control.
+			l.StopPlayback()
 			return false
 		}
+		var (
+			keys = l.app.Settings.Keys
+		)
 		switch event.Code {
-		case twodee.KeyZ:
-			l.level.Player.Roll()
-		case twodee.KeyM:
-			if twodee.MusicIsPaused() {
-				l.app.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(ResumeMusic))
-			} else {
-				l.app.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(PauseMusic))
-			}
+		case twodee.KeyCode(keys.Roll):
+			l.pressed |= RollButton
+		case twodee.KeyCode(keys.Charge):
+			l.pressed |= ChargeButton
+		case twodee.KeyCode(keys.Music):
+			l.app.SetMusic(!l.app.Settings.Music)
 		case twodee.Key0:
 			l.app.State.Debug = !l.app.State.Debug
 			fmt.Printf("Debug state: %v\n", l.app.State.Debug)
+			l.app.SaveSettings()
 			l.app.GameEventHandler.Enqueue(NewShakeEvent(3, 200, 3.0, 4.0, 1.0))
 		case twodee.Key1:
 			if l.app.State.Debug {
@@ -426,6 +614,24 @@ func (l *GameLayer) HandleEvent(evt twodee.Event) bool {
 			if l.app.State.Debug {
 				l.loadLevel("main")
 			}
+		case twodee.KeyF2:
+			l.quickSave = true
+		case twodee.KeyF3:
+			l.quickLoad = true
+		case twodee.KeyF9:
+			if l.app.State.Debug {
+				if l.recording != nil {
+					l.StopRecording()
+				} else {
+					l.StartRecording()
+				}
+			}
+		case twodee.KeyF1:
+			if l.app.State.Debug && l.lastReplay != "" {
+				if err := l.PlayReplay(l.lastReplay, false); err != nil {
+					fmt.Printf("Could not play replay: %v\n", err)
+				}
+			}
 		case twodee.Key9:
 			if l.app.State.Debug {
 				if l.level.Boss != nil {
@@ -437,12 +643,26 @@ func (l *GameLayer) HandleEvent(evt twodee.Event) bool {
 	return true
 }
 
-func (l *GameLayer) checkJoy() bool {
+// readInput collects this update's input from the joystick, or the keyboard
+// if there is none, along with any keys pressed since the last update.
+func (l *GameLayer) readInput() (input InputFrame) {
+	var (
+		ok bool
+	)
+	if input, ok = l.checkJoy(); !ok {
+		input = l.checkKeys()
+	}
+	input.Buttons |= l.pressed
+	l.pressed = 0
+	return
+}
+
+func (l *GameLayer) checkJoy() (input InputFrame, ok bool) {
 	var (
 		events = l.app.Context.Events
 	)
 	if !events.JoystickPresent(twodee.Joystick1) {
-		return false
+		return
 	}
 	var (
 		axes    []float32 = events.JoystickAxes(twodee.Joystick1)
@@ -456,38 +676,147 @@ func (l *GameLayer) checkJoy() bool {
 	if math.Abs(y) < 0.2 {
 		y = 0.0
 	}
-	l.level.Player.MoveX(float32(x))
-	l.level.Player.MoveY(float32(y))
+	input.X = float32(x)
+	input.Y = float32(y)
+	if math.Hypot(x, y) > 0.9 { // Full tilt runs.
+		input.Buttons |= RunButton
+	}
 	if len(buttons) > 11 && buttons[11] != 0 { // Very much hardcoded to xbox controller
-		l.level.Player.Roll()
+		input.Buttons |= RollButton
 	}
-	return true
+	if len(buttons) > 12 && buttons[12] != 0 {
+		// Only throw on the press, like the keyboard. Holding it would
+		// absorb a plate and throw the charge straight away.
+		if l.joyHeld&ChargeButton == 0 {
+			input.Buttons |= ChargeButton
+		}
+		l.joyHeld |= ChargeButton
+	} else {
+		l.joyHeld &^= ChargeButton
+	}
+	if len(buttons) > 13 && buttons[13] != 0 {
+		input.Buttons |= AimButton
+	}
+	if len(buttons) > 8 && buttons[8] != 0 {
+		input.Buttons |= RewindButton
+	}
+	return input, true
 }
 
-func (l *GameLayer) checkKeys() {
+func (l *GameLayer) checkKeys() (input InputFrame) {
 	var (
-		events         = l.app.Context.Events
-		down           = events.GetKey(twodee.KeyDown) == twodee.Press
-		up             = events.GetKey(twodee.KeyUp) == twodee.Press
-		left           = events.GetKey(twodee.KeyLeft) == twodee.Press
-		right          = events.GetKey(twodee.KeyRight) == twodee.Press
-		x      float32 = 0.0
-		y      float32 = 0.0
+		events = l.app.Context.Events
+		keys   = l.app.Settings.Keys
+		down   = keys.Down.Pressed(events)
+		up     = keys.Up.Pressed(events)
+		left   = keys.Left.Pressed(events)
+		right  = keys.Right.Pressed(events)
 	)
 	switch {
 	case down && !up:
-		y = -1.0
+		input.Y = -1.0
 	case up && !down:
-		y = 1.0
+		input.Y = 1.0
 	}
 	switch {
 	case left && !right:
-		x = -1.0
+		input.X = -1.0
 	case right && !left:
-		x = 1.0
+		input.X = 1.0
+	}
+	if keys.Run.Pressed(events) {
+		input.Buttons |= RunButton
+	}
+	if keys.Aim.Pressed(events) {
+		input.Buttons |= AimButton
+	}
+	if keys.Rewind.Pressed(events) {
+		input.Buttons |= RewindButton
+	}
+	return
+}
+
+// StartRecording restarts the current level and records input from there.
+func (l *GameLayer) StartRecording() {
+	l.StopPlayback()
+	l.recording = NewReplay(SimStep, l.level.Name, l.app.State)
+	l.loadLevel(l.level.Name)
+	fmt.Printf("Recording input\n")
+}
+
+// StopRecording saves the replay being recorded, if there is one.
+func (l *GameLayer) StopRecording() {
+	if l.recording == nil {
+		return
+	}
+	var (
+		path = fmt.Sprintf("replay-%v.json", time.Now().Format("20060102-150405"))
+	)
+	if err := l.recording.Save(path); err != nil {
+		fmt.Printf("Could not save replay: %v\n", err)
+	} else {
+		fmt.Printf("Saved %v of input to %v\n", l.recording.Duration(), path)
+		l.lastReplay = path
+	}
+	l.recording = nil
+}
+
+// PlayReplay plays back the replay at path, then returns to the level the
+// player was in. Attract mode replays return to the title screen instead.
+func (l *GameLayer) PlayReplay(path string, attract bool) (err error) {
+	var (
+		replay *Replay
+	)
+	if replay, err = LoadReplay(path, SimStep); err != nil {
+		return
+	}
+	l.StopRecording()
+	l.StopPlayback()
+	l.resume = NewReplay(SimStep, l.level.Name, l.app.State)
+	// Nothing to put back if the player's mid death, so they start the
+	// level over.
+	l.resumeAt, _ = l.level.MemorySnapshot()
+	l.playback = replay
+	l.app.Tracker.Paused = true
+	l.playbackFrame = 0
+	l.attract = attract
+	l.splash = ""
+	replay.Restore(l.app.State)
+	return l.loadLevel(replay.Level)
+}
+
+// StopPlayback ends the current replay, if there is one, and puts the game
+// back the way it was.
+func (l *GameLayer) StopPlayback() {
+	if l.playback == nil {
+		return
+	}
+	l.playback = nil
+	l.app.Tracker.Paused = false
+	l.resume.Restore(l.app.State)
+	if l.resumeAt == nil || l.loadSnapshot(l.resumeAt) != nil {
+		l.loadLevel(l.resume.Level)
+	}
+	l.resumeAt = nil
+	if l.attract {
+		l.splash = "splash"
+		l.idle = 0
+	}
+}
+
+// updateAttract starts the demo once the title screen has sat idle for
+// AttractDelay.
+func (l *GameLayer) updateAttract(elapsed time.Duration) {
+	if l.splash != "splash" {
+		return
+	}
+	if l.idle += elapsed; l.idle < AttractDelay {
+		return
+	}
+	l.idle = 0
+	if err := l.PlayReplay(AttractReplay, true); err != nil && l.app.State.Debug {
+		fmt.Printf("Could not play demo: %v\n", err)
 	}
-	l.level.Player.MoveX(x)
-	l.level.Player.MoveY(y)
 }
 
 func (l *GameLayer) loadSpritesheet() (err error) {
@@ -31,11 +31,13 @@ type Hud struct {
 	bossRedLine      *twodee.LineGeometry
 	bossGreenLine    *twodee.LineGeometry
 	bossBlueLine     *twodee.LineGeometry
+	chargeLine       *twodee.LineGeometry
 	blackStyle       *twodee.LineStyle
 	whiteStyle       *twodee.LineStyle
 	redStyle         *twodee.LineStyle
 	greenStyle       *twodee.LineStyle
 	blueStyle        *twodee.LineStyle
+	chargeStyle      *twodee.LineStyle
 	levelRed         float32
 	levelGreen       float32
 	levelBlue        float32
@@ -61,6 +63,7 @@ func newHud() (hud *Hud, err error) {
 		bossRedLine:    twodee.NewLineGeometry([]mgl32.Vec2{mgl32.Vec2{5.8, 4.6}, mgl32.Vec2{5.87, 4.6}}, false),
 		bossGreenLine:  twodee.NewLineGeometry([]mgl32.Vec2{mgl32.Vec2{5.8, 4.3}, mgl32.Vec2{5.87, 4.3}}, false),
 		bossBlueLine:   twodee.NewLineGeometry([]mgl32.Vec2{mgl32.Vec2{5.8, 4}, mgl32.Vec2{5.87, 4}}, false),
+		chargeLine:     twodee.NewLineGeometry([]mgl32.Vec2{mgl32.Vec2{5.8, 3.6}, mgl32.Vec2{6.3, 3.6}}, false),
 		blackStyle: &twodee.LineStyle{
 			Thickness: 0.15,
 			Color:     color.RGBA{0, 0, 0, 128},
@@ -86,6 +89,11 @@ func newHud() (hud *Hud, err error) {
 			Color:     color.RGBA{0, 0, 255, 128},
 			Inner:     0.0,
 		},
+		chargeStyle: &twodee.LineStyle{
+			Thickness: 0.25,
+			Color:     color.RGBA{0, 0, 0, 0},
+			Inner:     0.0,
+		},
 		levelRed:         0.0,
 		levelGreen:       0.0,
 		levelBlue:        0.0,
@@ -169,5 +177,15 @@ func (h *Hud) UpdateLines(l *Level, initialLoad bool) {
 		h.bossBlueLine = twodee.NewLineGeometry([]mgl32.Vec2{mgl32.Vec2{5.8, 4}, mgl32.Vec2{5.87, 4}}, false)
 	}
 
+	// tint the charge marker with the color the player is carrying
+	if l.Player.Charged {
+		h.chargeStyle.Color = color.RGBA{
+			uint8(255 * math.Min(float64(l.Player.Charge[0]), 1.0)),
+			uint8(255 * math.Min(float64(l.Player.Charge[1]), 1.0)),
+			uint8(255 * math.Min(float64(l.Player.Charge[2]), 1.0)),
+			192,
+		}
+	}
+
 	return
 }
@@ -16,7 +16,9 @@ package main
 
 import (
 	"../lib/twodee"
+	"./pathfinding"
 	"encoding/hex"
+	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/pikkpoiss/tmxgo"
 	"io/ioutil"
@@ -25,87 +27,270 @@ import (
 )
 
 type Level struct {
-	Name            string
-	Player          *Player
-	Boss            *Boss
-	Props           PropList
-	Background      *twodee.Batch
-	Sheet           *twodee.Spritesheet
-	Collisions      *twodee.Grid
-	BossCollisions  *twodee.Grid
-	Portals         []Portal
-	Plates          PropList
-	Width           float32
-	Height          float32
-	Color           mgl32.Vec3
-	events          *twodee.GameEventHandler
-	colorObserverId int
-	BossPath        []twodee.GridPoint
+	Name           string
+	Player         *Player
+	Boss           *Boss
+	Props          PropList
+	Background     *twodee.Batch
+	Sheet          *twodee.Spritesheet
+	Collisions     *twodee.Grid
+	BossCollisions *twodee.Grid
+	Portals        []Portal
+	Plates         PropList
+	Width          float32
+	Height         float32
+	Color          mgl32.Vec3
+	events         *EventBus
+	subs           Subscriptions
+	BossPath       []mgl32.Vec2
+	Noises         []*NoiseEvent
+	Pathfinder     *pathfinding.Pathfinder
+	PlayerField    *pathfinding.FlowField
+	Projectiles    ProjectileList
+	prevPos        map[bounded]mgl32.Vec2
 }
 
+// bounded is anything drawn at its bounds which may move between updates.
+type bounded interface {
+	Bounds() twodee.Rectangle
+}
+
+const (
+	// BossRadius is the clearance paths leave around bosses.
+	BossRadius = 0.4
+	// PathCacheSize is how many boss paths each level remembers.
+	PathCacheSize = 64
+)
+
 type Portal struct {
 	Rect  twodee.Rectangle
 	Level string
 }
 
-func NewLevel(name string, mapPath string, sheet *twodee.Spritesheet, events *twodee.GameEventHandler) (level *Level, err error) {
+func NewLevel(name string, mapPath string, sheet *twodee.Spritesheet, events *EventBus) (level *Level, err error) {
+	return newLevel(name, mapPath, sheet, events, true)
+}
+
+// newLevel loads a level, leaving out the background if it won't be drawn so
+// that the simulation can run without a GL context.
+func newLevel(name string, mapPath string, sheet *twodee.Spritesheet, events *EventBus, background bool) (level *Level, err error) {
 	level = &Level{
-		Boss:   nil,
-		Player: NewPlayer(events, sheet),
-		Props:  NewPropList(),
-		Plates: NewPropList(),
-		Sheet:  sheet,
-		events: events,
-		Name:   name,
+		Boss:        nil,
+		Player:      NewPlayer(events, sheet),
+		Props:       NewPropList(),
+		Plates:      NewPropList(),
+		Projectiles: ProjectileList{},
+		prevPos:     map[bounded]mgl32.Vec2{},
+		Sheet:       sheet,
+		events:      events,
+		Name:        name,
 	}
 	level.Props = append(level.Props, level.Player)
-	if err = level.loadMap(mapPath); err != nil {
+	if err = level.loadMap(mapPath, background); err != nil {
 		return
 	}
 	if level.Boss != nil {
 		level.Props = append(level.Props, level.Boss)
 	}
-	level.colorObserverId = events.AddObserver(ChangeColor, level.changeColor)
+	level.subs.Add(
+		Subscribe(events, ChangeColor, level.changeColor),
+		Subscribe(events, Noise, level.noise),
+	)
 	return
 }
 
-func (l *Level) SetBossPath(path []twodee.GridPoint) {
+// SpawnProjectile adds a projectile to the level. It is updated and drawn
+// until it hits something or expires.
+func (l *Level) SpawnProjectile(p *Projectile) {
+	l.Projectiles = append(l.Projectiles, p)
+}
+
+func (l *Level) SetBossPath(path []mgl32.Vec2) {
 	l.BossPath = path
 }
 
-func (l *Level) changeColor(e twodee.GETyper) {
-	if event, ok := e.(*ColorEvent); ok {
-		var (
-			sentEvent = false
-		)
-		l.events.Enqueue(twodee.NewBasicGameEvent(PlayColorChangeEffect))
-		if event.Add {
-			l.Color = l.Color.Add(event.Color)
-		} else {
-			l.Color = l.Color.Sub(event.Color)
+func (l *Level) changeColor(event *ColorEvent) {
+	var (
+		sentEvent = false
+	)
+	if event.Add {
+		l.Color = l.Color.Add(event.Color)
+	} else {
+		l.Color = l.Color.Sub(event.Color)
+	}
+	if l.matchBossColor() {
+		sentEvent = true
+	}
+	if !sentEvent {
+		l.events.Enqueue(NewShakeEvent(1, 200, 0.4, 2.0, 1.0))
+	}
+}
+
+// noise records a noise so that mobs can react to it during the next update.
+func (l *Level) noise(event *NoiseEvent) {
+	l.Noises = append(l.Noises, event)
+}
+
+// matchBossColor moves the boss on to its next color if the level's color
+// matches its current one. Returns true if it did.
+func (l *Level) matchBossColor() bool {
+	if l.Boss == nil || l.Boss.Invulnerable() || l.Color.Sub(l.Boss.Color).Len() >= 0.1 {
+		return false
+	}
+	l.Boss.NextColor()
+	l.events.Enqueue(NewShakeEvent(2, 1000, 1.0, 10.0, 1.0))
+	return true
+}
+
+// chargeHit applies a color charge thrown by the player to the boss it hit.
+func (l *Level) chargeHit(p *Projectile, target Prop) {
+	boss, ok := target.(*Boss)
+	if !ok || boss.Invulnerable() || boss.Dead {
+		return
+	}
+	var phase = boss.Phase
+	if !boss.ApplyCharge(p.Color) {
+		return // Wrong color, shrugged off.
+	}
+	if boss.Phase != phase || l.matchBossColor() {
+		l.events.Enqueue(NewShakeEvent(2, 1000, 1.0, 10.0, 1.0))
+	} else {
+		l.events.Enqueue(NewShakeEvent(1, 300, 0.6, 4.0, 1.0))
+	}
+}
+
+// snapshot remembers where everything was before an update.
+func (l *Level) snapshot() {
+	for k := range l.prevPos {
+		delete(l.prevPos, k)
+	}
+	for _, p := range l.Props {
+		l.prevPos[p] = p.Bounds().Min.Vec2
+	}
+	for _, p := range l.Projectiles {
+		l.prevPos[p] = p.Bounds().Min.Vec2
+	}
+}
+
+// Interpolate moves a sprite drawn for b back toward where b was before the
+// latest update. alpha is how far the frame is between that update and the
+// next one, from 0 to 1.
+func (l *Level) Interpolate(b bounded, config twodee.SpriteConfig, alpha float32) twodee.SpriteConfig {
+	prev, ok := l.prevPos[b]
+	if !ok {
+		return config
+	}
+	d := prev.Sub(b.Bounds().Min.Vec2).Mul(1 - alpha)
+	config.View.X += d[0]
+	config.View.Y += d[1]
+	return config
+}
+
+// LevelSnapshot is the state of a level partway through play, enough to
+// pick up exactly where it was left.
+type LevelSnapshot struct {
+	Level       string               `json:"level"`
+	Color       mgl32.Vec3           `json:"color"`
+	Player      PlayerSnapshot       `json:"player"`
+	Plates      []PlateSnapshot      `json:"plates"`
+	Boss        *BossSnapshot        `json:"boss,omitempty"`
+	Projectiles []ProjectileSnapshot `json:"projectiles"`
+}
+
+// Snapshot captures the level between updates. Fails once the player or the
+// boss has died, since there is nothing left to come back to.
+func (l *Level) Snapshot() (s *LevelSnapshot, err error) {
+	return l.capture(false)
+}
+
+// MemorySnapshot captures the level like Snapshot, but much more cheaply,
+// for snapshots which are only ever restored and never written out.
+func (l *Level) MemorySnapshot() (s *LevelSnapshot, err error) {
+	return l.capture(true)
+}
+
+func (l *Level) capture(inMemory bool) (s *LevelSnapshot, err error) {
+	s = &LevelSnapshot{
+		Level:       l.Name,
+		Color:       l.Color,
+		Plates:      make([]PlateSnapshot, 0, len(l.Plates)),
+		Projectiles: make([]ProjectileSnapshot, 0, len(l.Projectiles)),
+	}
+	if s.Player, err = l.Player.Snapshot(); err != nil {
+		return nil, err
+	}
+	for _, p := range l.Plates {
+		s.Plates = append(s.Plates, p.(*Plate).Snapshot())
+	}
+	if l.Boss != nil {
+		if s.Boss, err = l.Boss.snapshot(inMemory); err != nil {
+			return nil, err
 		}
-		if l.Boss != nil {
-			if l.Color.Sub(l.Boss.Color).Len() < 0.1 {
-				l.Boss.NextColor()
-				l.events.Enqueue(NewShakeEvent(2, 1000, 1.0, 10.0, 1.0))
-				sentEvent = true
-			}
+	}
+	for _, p := range l.Projectiles {
+		if !p.Dead {
+			s.Projectiles = append(s.Projectiles, p.Snapshot())
+		}
+	}
+	return
+}
+
+// Restore puts the level back the way it was when s was captured, either
+// freshly loaded or partway through play. Bosses can't be brought back to
+// life, so a level whose boss has died can't be restored.
+func (l *Level) Restore(s *LevelSnapshot) (err error) {
+	if s.Level != l.Name {
+		return fmt.Errorf("Snapshot is of level %v, not %v", s.Level, l.Name)
+	}
+	if len(s.Plates) != len(l.Plates) {
+		return fmt.Errorf("Snapshot has %v plates, level has %v", len(s.Plates), len(l.Plates))
+	}
+	if (s.Boss == nil) != (l.Boss == nil) {
+		return fmt.Errorf("Snapshot doesn't match the boss in level %v", l.Name)
+	}
+	if l.Boss != nil {
+		if l.Boss.Dead {
+			return fmt.Errorf("Boss %v is dead", l.Boss.Name)
 		}
-		if !sentEvent {
-			l.events.Enqueue(NewShakeEvent(1, 200, 0.4, 2.0, 1.0))
+		if err = l.Boss.Restore(s.Boss); err != nil {
+			return
 		}
 	}
+	l.Color = s.Color
+	l.Player.Restore(s.Player)
+	for i, p := range l.Plates {
+		p.(*Plate).Restore(s.Plates[i])
+	}
+	l.Projectiles = l.Projectiles[:0]
+	for _, p := range s.Projectiles {
+		var onHit = l.chargeHit
+		if p.Owner == BossProjectile {
+			if l.Boss == nil {
+				continue
+			}
+			onHit = l.Boss.boltHit
+		}
+		projectile := NewProjectile(p.Pos, p.Velocity, p.Lifetime, p.Color, p.Owner, onHit)
+		projectile.elapsed = p.Elapsed
+		l.Projectiles = append(l.Projectiles, projectile)
+	}
+	l.BossPath = nil
+	l.Noises = l.Noises[:0]
+	l.snapshot()
+	return
 }
 
 func (l *Level) Update(elapsed time.Duration) {
+	l.snapshot()
 	// TODO: Probably this should update a slice of Mobs or other
 	// updateable things in the level.
 	if l.Boss != nil {
 		l.Boss.Update(elapsed)
 		if !l.Boss.Dead {
+			l.PlayerField.SetGoal(l.Player.Pos().Vec2)
 			l.Boss.ExamineWorld(l)
 		}
-		if !l.Boss.Dead && !l.Player.Dead && l.Boss.Bounds().Overlaps(l.Player.Bounds()) {
+		if !l.Boss.Dead && !l.Boss.Invulnerable() && !l.Player.Dead && l.Boss.Bounds().Overlaps(l.Player.Bounds()) {
 			l.events.Enqueue(NewPlayerDiedEvent())
 		}
 	}
@@ -113,16 +298,16 @@ func (l *Level) Update(elapsed time.Duration) {
 		l.Player.UpdateLevel(elapsed, l)
 		l.Plates.Update(elapsed)
 		l.Plates.CheckCollision(l.Player)
+		l.Projectiles = l.Projectiles.Update(elapsed, l)
 	}
+	l.Noises = l.Noises[:0]
 }
 
 func (l *Level) Delete() {
-	if l.colorObserverId != 0 {
-		l.events.RemoveObserver(ChangeColor, l.colorObserverId)
-	}
+	l.subs.Release()
 }
 
-func (l *Level) loadMap(path string) (err error) {
+func (l *Level) loadMap(path string, background bool) (err error) {
 	var (
 		data        []byte
 		m           *tmxgo.Map
@@ -139,6 +324,12 @@ func (l *Level) loadMap(path string) (err error) {
 	}
 	l.Collisions = twodee.NewGrid(m.Width, m.Height)
 	l.BossCollisions = twodee.NewGrid(m.Width, m.Height)
+	l.Pathfinder = pathfinding.NewPathfinder(
+		pathfinding.NewMap(l.BossCollisions, m.Width, m.Height, 0.5),
+		BossRadius,
+		PathCacheSize,
+	)
+	l.PlayerField = pathfinding.NewFlowField(l.Pathfinder.Map)
 	l.Width = float32(m.Width*m.TileWidth) / PxPerUnit
 	l.Height = float32(m.Height*m.TileHeight) / PxPerUnit
 	if tiles, err = m.TilesFromLayerName("collision"); err == nil {
@@ -211,7 +402,9 @@ func (l *Level) loadMap(path string) (err error) {
 			}
 		}
 	}
-	l.Background, err = twodee.LoadBatch(textiles, tilem)
+	if background {
+		l.Background, err = twodee.LoadBatch(textiles, tilem)
+	}
 	return
 }
 
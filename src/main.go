@@ -16,6 +16,7 @@ package main
 
 import (
 	"../lib/twodee"
+	"flag"
 	"fmt"
 	"github.com/go-gl/gl/v3.3-core/gl"
 	"runtime"
@@ -27,37 +28,98 @@ func init() {
 	runtime.LockOSThread()
 }
 
+const (
+	// SimStep is how far the simulation advances with each update.
+	SimStep = twodee.Step60Hz
+	// MaxFrameTime caps how much time a single frame can feed the
+	// simulation, so that a long stall doesn't turn into a long catch up.
+	MaxFrameTime = 250 * time.Millisecond
+)
+
+// Options are set from the command line.
+type Options struct {
+	// TracePath is where to write an event trace from startup, if set.
+	TracePath string
+	// ReplayPath is a replay to play on startup, if set.
+	ReplayPath string
+	// FrameLimit caps the frame rate, if above zero.
+	FrameLimit int
+	// VSync waits for the display to refresh before swapping buffers.
+	VSync bool
+}
+
 type Application struct {
 	layers           *twodee.Layers
 	counter          *twodee.Counter
 	font             *twodee.FontFace
 	Context          *twodee.Context
 	State            *State
-	GameEventHandler *twodee.GameEventHandler
-	AudioSystem      *AudioSystem
+	GameEventHandler *EventBus
+	// Alpha is how far between the last update and the next one the
+	// current frame is drawn, from 0 to 1.
+	Alpha       float32
+	AudioSystem *AudioSystem
+	// Settings are the player's choices, saved whenever they change.
+	Settings *Settings
+	// Tracker counts stats and unlocks achievements.
+	Tracker *StatsTracker
+	// Speedrun times runs against the personal bests in the splits file.
+	Speedrun *SpeedrunTimer
+	// Saves holds the progress in each save slot, nil for empty slots.
+	Saves []*SaveGame
+	// Slot is the save slot being played.
+	Slot int
+	// SaveMessage explains why progress couldn't be loaded, if it couldn't.
+	SaveMessage  string
+	unreadable   []bool
+	saveDir      string
+	settingsPath string
+	winbounds    twodee.Rectangle
+	game         *GameLayer
+	// thumbnailPending is set when a save is waiting for its screenshot,
+	// which goes to thumbnailSlot.
+	thumbnailPending bool
+	thumbnailSlot    int
 }
 
-func NewApplication() (app *Application, err error) {
+// NewApplication creates the window and everything in it. settings are
+// loaded from settingsPath, which is where changes to them are saved.
+func NewApplication(opts Options, settings *Settings, settingsPath string) (app *Application, err error) {
 	var (
 		name             = "Ludum Dare 32"
 		layers           *twodee.Layers
 		context          *twodee.Context
 		gamelayer        *GameLayer
 		menulayer        *MenuLayer
-		winbounds        = twodee.Rect(0, 0, 1024, 640)
+		tracelayer       *TraceLayer
+		toastlayer       *ToastLayer
+		speedrunlayer    *SpeedrunLayer
+		winbounds        = twodee.Rect(0, 0, float32(settings.WindowWidth), float32(settings.WindowHeight))
 		counter          = twodee.NewCounter()
 		state            = NewState()
-		gameEventHandler = twodee.NewGameEventHandler(NumGameEventTypes)
+		gameEventHandler = NewEventBus(NumGameEventTypes, IsRenderEvent)
 		audioSystem      *AudioSystem
 	)
+	if opts.TracePath != "" {
+		// Start before anything subscribes so the trace sees everything.
+		if err = StartTrace(gameEventHandler, opts.TracePath); err != nil {
+			return
+		}
+	}
 	if context, err = twodee.NewContext(); err != nil {
 		return
 	}
-	context.SetFullscreen(false)
+	context.SetFullscreen(settings.Fullscreen)
 	context.SetCursor(false)
 	if err = context.CreateWindow(int(winbounds.Max.X()), int(winbounds.Max.Y()), name); err != nil {
 		return
 	}
+	if opts.VSync {
+		context.SetSwapInterval(1)
+	} else {
+		context.SetSwapInterval(0)
+	}
+	state.Debug = settings.Debug
 	layers = twodee.NewLayers()
 	app = &Application{
 		layers:           layers,
@@ -65,18 +127,42 @@ func NewApplication() (app *Application, err error) {
 		Context:          context,
 		State:            state,
 		GameEventHandler: gameEventHandler,
+		Settings:         settings,
+		settingsPath:     settingsPath,
+		winbounds:        winbounds,
 	}
+	app.loadProgress()
+	app.Tracker = NewStatsTracker(state, gameEventHandler, app.loadAchievements())
+	app.loadSplits()
 	if gamelayer, err = NewGameLayer(winbounds, app); err != nil {
 		return
 	}
 	layers.Push(gamelayer)
+	app.game = gamelayer
 	if audioSystem, err = NewAudioSystem(app); err != nil {
 		return
 	}
+	if toastlayer, err = NewToastLayer(winbounds, app); err != nil {
+		return
+	}
+	layers.Push(toastlayer)
+	if speedrunlayer, err = NewSpeedrunLayer(winbounds, app, gamelayer); err != nil {
+		return
+	}
+	layers.Push(speedrunlayer)
 	if menulayer, err = NewMenuLayer(winbounds, state, app); err != nil {
 		return
 	}
 	layers.Push(menulayer)
+	if tracelayer, err = NewTraceLayer(winbounds, app); err != nil {
+		return
+	}
+	layers.Push(tracelayer)
+	if opts.ReplayPath != "" {
+		if err = gamelayer.PlayReplay(opts.ReplayPath, false); err != nil {
+			return
+		}
+	}
 	app.AudioSystem = audioSystem
 	fmt.Printf("OpenGL version: %s\n", context.OpenGLVersion)
 	fmt.Printf("Shader version: %s\n", context.ShaderVersion)
@@ -85,16 +171,31 @@ func NewApplication() (app *Application, err error) {
 
 func (a *Application) Draw() {
 	a.counter.Incr()
+	if a.GameEventHandler.Trace != nil {
+		a.GameEventHandler.Trace.NextFrame()
+	}
+	a.captureThumbnail()
 	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 	a.layers.Render()
 }
 
 func (a *Application) Update(elapsed time.Duration) {
+	a.GameEventHandler.PollSim()
+	if a.GameEventHandler.Trace != nil {
+		a.GameEventHandler.Trace.Step(elapsed)
+	}
 	a.layers.Update(elapsed)
+	a.AudioSystem.Update(elapsed)
 }
 
 func (a *Application) Delete() {
+	if a.State.Playing {
+		a.SaveProgress()
+		// There won't be another frame to take the screenshot from.
+		a.captureThumbnail()
+	}
 	a.layers.Delete()
+	a.Tracker.Delete()
 	a.Context.Delete()
 	a.AudioSystem.Delete()
 }
@@ -122,30 +223,58 @@ func (a *Application) ProcessEvents() {
 
 func main() {
 	var (
-		app *Application
-		err error
+		app          *Application
+		err          error
+		opts         Options
+		settings     *Settings
+		settingsPath string
 	)
+	if dir, err := SaveDir(); err != nil {
+		fmt.Printf("Settings can't be saved: %v\n", err)
+	} else {
+		settingsPath = SettingsPath(dir)
+	}
+	// Settings are loaded first so that they can be overridden by flags.
+	if settings, err = LoadSettings(settingsPath); err != nil {
+		fmt.Printf("Could not load settings: %v\n", err)
+	}
+	flag.StringVar(&opts.TracePath, "trace", "", "Write every game event to this JSON lines file")
+	flag.StringVar(&opts.ReplayPath, "replay", "", "Play back this replay file on startup")
+	flag.IntVar(&opts.FrameLimit, "fps", 0, "Limit the frame rate, 0 for no limit")
+	flag.BoolVar(&opts.VSync, "vsync", settings.VSync, "Wait for the display to refresh between frames")
+	flag.Parse()
 
-	if app, err = NewApplication(); err != nil {
+	if app, err = NewApplication(opts, settings, settingsPath); err != nil {
 		panic(err)
 	}
 	defer app.Delete()
 
 	var (
-		current_time = time.Now()
-		updated_to   = current_time
-		step         = twodee.Step60Hz
+		previous    = time.Now()
+		accumulator time.Duration
 	)
 	for !app.Context.ShouldClose() && !app.State.Exit {
+		var (
+			start = time.Now()
+			frame = start.Sub(previous) // Monotonic.
+		)
+		previous = start
+		if frame > MaxFrameTime {
+			frame = MaxFrameTime
+		}
+		accumulator += frame
 		app.Context.Events.Poll()
-		app.GameEventHandler.Poll()
+		app.GameEventHandler.PollRender()
 		app.ProcessEvents()
-		for !updated_to.After(current_time) {
-			app.Update(step)
-			updated_to = updated_to.Add(step)
+		for accumulator >= SimStep {
+			app.Update(SimStep)
+			accumulator -= SimStep
 		}
-		current_time = current_time.Add(step)
+		app.Alpha = float32(accumulator) / float32(SimStep)
 		app.Draw()
 		app.Context.SwapBuffers()
+		if opts.FrameLimit > 0 {
+			time.Sleep(time.Second/time.Duration(opts.FrameLimit) - time.Since(start))
+		}
 	}
 }
@@ -18,11 +18,21 @@ import (
 	"../lib/twodee"
 	"fmt"
 	"image/color"
+	"sort"
 	"time"
 )
 
 const (
 	ProgramCode int32 = iota
+	// The slot codes carry the slot as their value.
+	SlotContinueCode
+	SlotNewGameCode
+	SlotDeleteCode
+	// SlotCopyCode's value is from*SaveSlots + to.
+	SlotCopyCode
+	OptionCode
+	// InfoCode items only show information.
+	InfoCode
 )
 
 const (
@@ -30,6 +40,29 @@ const (
 	DebugCode
 )
 
+// Values for OptionCode.
+const (
+	MusicOption int32 = iota
+	MasterUpOption
+	MasterDownOption
+	MusicUpOption
+	MusicDownOption
+	EffectsUpOption
+	EffectsDownOption
+	FullscreenOption
+	WindowSizeOption
+	VSyncOption
+	ScreenShakeOption
+	FlashingOption
+	SpeedrunOption
+	// OverwriteSettingsOption saves over a settings file which couldn't be
+	// read.
+	OverwriteSettingsOption
+)
+
+// VolumeStep is how much the volume options change the volume by.
+const VolumeStep = 10
+
 type MenuLayer struct {
 	visible  bool
 	menu     *twodee.Menu
@@ -38,6 +71,14 @@ type MenuLayer struct {
 	cache    map[int]*twodee.TextCache
 	hicache  *twodee.TextCache
 	actcache *twodee.TextCache
+	msgcache *twodee.TextCache
+	message  string
+	// slots maps menu items to the save slot they're about.
+	slots  map[twodee.MenuItem]int
+	thumbs map[int]*twodee.Texture
+	// choosing keeps the menu up until the player continues or starts a new
+	// game.
+	choosing bool
 	camera   *twodee.Camera
 	state    *State
 	app      *Application
@@ -46,7 +87,6 @@ type MenuLayer struct {
 func NewMenuLayer(winb twodee.Rectangle, state *State, app *Application) (layer *MenuLayer, err error) {
 	var (
 		camera  *twodee.Camera
-		menu    *twodee.Menu
 		regfont *twodee.FontFace
 		hifont  *twodee.FontFace
 		actfont *twodee.FontFace
@@ -62,31 +102,201 @@ func NewMenuLayer(winb twodee.Rectangle, state *State, app *Application) (layer
 	if actfont, err = twodee.NewFontFace(font, 32, color.RGBA{200, 200, 255, 255}, bg); err != nil {
 		return
 	}
-	menu, err = twodee.NewMenu([]twodee.MenuItem{
-		twodee.NewKeyValueMenuItem("Exit", ProgramCode, ExitCode),
-		twodee.NewKeyValueMenuItem("Debug", ProgramCode, DebugCode),
-	})
-	if err != nil {
-		return
-	}
 	if camera, err = twodee.NewCamera(winb, winb); err != nil {
 		return
 	}
 	layer = &MenuLayer{
 		app:      app,
-		menu:     menu,
 		regfont:  regfont,
 		cache:    map[int]*twodee.TextCache{},
 		actcache: twodee.NewTextCache(actfont),
 		hicache:  twodee.NewTextCache(hifont),
+		msgcache: twodee.NewTextCache(regfont),
+		message:  app.SaveMessage,
 		camera:   camera,
 		state:    state,
-		visible:  false,
+		visible:  app.CurrentSave() != nil || app.SaveMessage != "",
+		choosing: app.CurrentSave() != nil,
+		thumbs:   map[int]*twodee.Texture{},
+	}
+	if err = layer.rebuild(); err != nil {
+		return
 	}
 	err = layer.Reset()
 	return
 }
 
+// rebuild creates the menu to match the save slots.
+func (ml *MenuLayer) rebuild() (err error) {
+	var (
+		items   = []twodee.MenuItem{}
+		slots   = []twodee.MenuItem{}
+		empty   = -1
+		menu    *twodee.Menu
+		options = []twodee.MenuItem{
+			twodee.NewKeyValueMenuItem("Music On/Off", OptionCode, MusicOption),
+			twodee.NewKeyValueMenuItem("Master Louder", OptionCode, MasterUpOption),
+			twodee.NewKeyValueMenuItem("Master Quieter", OptionCode, MasterDownOption),
+			twodee.NewKeyValueMenuItem("Music Louder", OptionCode, MusicUpOption),
+			twodee.NewKeyValueMenuItem("Music Quieter", OptionCode, MusicDownOption),
+			twodee.NewKeyValueMenuItem("Effects Louder", OptionCode, EffectsUpOption),
+			twodee.NewKeyValueMenuItem("Effects Quieter", OptionCode, EffectsDownOption),
+			twodee.NewKeyValueMenuItem("Fullscreen", OptionCode, FullscreenOption),
+			twodee.NewKeyValueMenuItem("Window Size", OptionCode, WindowSizeOption),
+			twodee.NewKeyValueMenuItem("VSync", OptionCode, VSyncOption),
+			twodee.NewKeyValueMenuItem("Screen Shake", OptionCode, ScreenShakeOption),
+			twodee.NewKeyValueMenuItem("Reduce Flashing", OptionCode, FlashingOption),
+			twodee.NewKeyValueMenuItem("Speedrun Timer", OptionCode, SpeedrunOption),
+		}
+	)
+	if ml.app.Settings.Unreadable() {
+		options = append(options, twodee.NewParentMenuItem("Save Over Settings File", []twodee.MenuItem{
+			twodee.NewKeyValueMenuItem("Really Save Over", OptionCode, OverwriteSettingsOption),
+			twodee.NewBackMenuItem("Back"),
+		}))
+	}
+	options = append(options, twodee.NewBackMenuItem("Back"))
+	ml.deleteThumbs()
+	ml.slots = map[twodee.MenuItem]int{}
+	for i, save := range ml.app.Saves {
+		var (
+			children = []twodee.MenuItem{}
+			add      = func(item twodee.MenuItem) {
+				ml.slots[item] = i
+				children = append(children, item)
+			}
+		)
+		if save != nil {
+			add(twodee.NewKeyValueMenuItem("Continue", SlotContinueCode, int32(i)))
+		} else if empty < 0 {
+			empty = i
+		}
+		add(twodee.NewKeyValueMenuItem("New Game", SlotNewGameCode, int32(i)))
+		if save != nil {
+			for j := range ml.app.Saves {
+				if j != i {
+					label := fmt.Sprintf("Copy to Slot %v", j+1)
+					add(twodee.NewKeyValueMenuItem(label, SlotCopyCode, int32(i*SaveSlots+j)))
+				}
+			}
+			add(twodee.NewParentMenuItem("Delete", []twodee.MenuItem{
+				twodee.NewKeyValueMenuItem("Really Delete", SlotDeleteCode, int32(i)),
+				twodee.NewBackMenuItem("Back"),
+			}))
+		}
+		add(twodee.NewBackMenuItem("Back"))
+		slot := twodee.NewParentMenuItem(slotLabel(i, save), children)
+		ml.slots[slot] = i
+		slots = append(slots, slot)
+	}
+	slots = append(slots, twodee.NewBackMenuItem("Back"))
+	if save := ml.app.CurrentSave(); save != nil {
+		items = append(items, twodee.NewKeyValueMenuItem("Continue", SlotContinueCode, int32(ml.app.Slot)))
+	}
+	if empty >= 0 {
+		items = append(items, twodee.NewKeyValueMenuItem("New Game", SlotNewGameCode, int32(empty)))
+	}
+	items = append(items,
+		twodee.NewParentMenuItem("Save Slots", slots),
+		twodee.NewParentMenuItem("Stats", ml.statsItems()),
+		twodee.NewParentMenuItem("Options", options),
+		twodee.NewKeyValueMenuItem("Exit", ProgramCode, ExitCode),
+		twodee.NewKeyValueMenuItem("Debug", ProgramCode, DebugCode),
+	)
+	if menu, err = twodee.NewMenu(items); err != nil {
+		return
+	}
+	ml.menu = menu
+	return
+}
+
+func slotLabel(slot int, save *SaveGame) string {
+	if save == nil {
+		return fmt.Sprintf("Slot %v - Empty", slot+1)
+	}
+	return fmt.Sprintf("Slot %v - %v/%v %v %v",
+		slot+1,
+		len(save.KilledBosses),
+		len(RequiredBosses),
+		formatDuration(save.Playtime),
+		save.SavedAt.Format("Jan 2 15:04"),
+	)
+}
+
+// formatDuration shows d as hours, minutes and seconds.
+func formatDuration(d time.Duration) string {
+	var (
+		s = d / time.Second
+	)
+	return fmt.Sprintf("%v:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// statsItems lists the current game's stats, and every achievement.
+func (ml *MenuLayer) statsItems() (items []twodee.MenuItem) {
+	var (
+		stats  = ml.state.Stats
+		levels = make([]string, 0, len(stats.LevelTime))
+		info   = func(format string, args ...interface{}) {
+			items = append(items, twodee.NewKeyValueMenuItem(fmt.Sprintf(format, args...), InfoCode, 0))
+		}
+	)
+	info("Playtime %v", formatDuration(ml.state.Playtime))
+	info("Deaths %v", stats.Deaths)
+	info("Rolls %v", stats.Rolls)
+	info("Plates lit %v", stats.ColorChanges)
+	info("Phases cleared %v", stats.PhasesCleared)
+	info("Bosses killed %v", stats.BossesKilled)
+	for level := range stats.LevelTime {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		info("Time in %v %v", level, formatDuration(stats.LevelTime[level]))
+	}
+	if a := ml.app.Tracker.Achievements; a != nil {
+		var (
+			achievements = []twodee.MenuItem{}
+			unlocked     = 0
+		)
+		for _, achievement := range a.All {
+			mark := " "
+			if _, ok := a.Unlocked[achievement.ID]; ok {
+				mark = "*"
+				unlocked++
+			}
+			label := fmt.Sprintf("%v %v - %v", mark, achievement.Name, achievement.Description)
+			achievements = append(achievements, twodee.NewKeyValueMenuItem(label, InfoCode, 0))
+		}
+		achievements = append(achievements, twodee.NewBackMenuItem("Back"))
+		label := fmt.Sprintf("Achievements %v/%v", unlocked, len(a.All))
+		items = append(items, twodee.NewParentMenuItem(label, achievements))
+	}
+	items = append(items, twodee.NewBackMenuItem("Back"))
+	return
+}
+
+// thumbnail returns the screenshot for a slot, if it has one.
+func (ml *MenuLayer) thumbnail(slot int) *twodee.Texture {
+	texture, ok := ml.thumbs[slot]
+	if !ok && ml.app.Saves[slot] != nil && ml.app.saveDir != "" {
+		var err error
+		if texture, err = twodee.LoadTexture(ThumbnailPath(ml.app.saveDir, slot), twodee.Nearest); err != nil {
+			texture = nil
+		}
+		ml.thumbs[slot] = texture
+	}
+	return texture
+}
+
+func (ml *MenuLayer) deleteThumbs() {
+	for slot, texture := range ml.thumbs {
+		if texture != nil {
+			texture.Delete()
+		}
+		delete(ml.thumbs, slot)
+	}
+}
+
 func (ml *MenuLayer) Reset() (err error) {
 	if ml.text != nil {
 		ml.text.Delete()
@@ -96,9 +306,11 @@ func (ml *MenuLayer) Reset() (err error) {
 	}
 	ml.actcache.Clear()
 	ml.hicache.Clear()
+	ml.msgcache.Clear()
 	for _, v := range ml.cache {
 		v.Clear()
 	}
+	ml.deleteThumbs()
 	return
 }
 
@@ -106,9 +318,11 @@ func (ml *MenuLayer) Delete() {
 	ml.text.Delete()
 	ml.actcache.Delete()
 	ml.hicache.Delete()
+	ml.msgcache.Delete()
 	for _, v := range ml.cache {
 		v.Delete()
 	}
+	ml.deleteThumbs()
 }
 
 func (ml *MenuLayer) Render() {
@@ -142,6 +356,22 @@ func (ml *MenuLayer) Render() {
 			ml.text.Draw(texture, 0, y)
 		}
 	}
+	for _, item := range ml.menu.Items() {
+		if slot, ok := ml.slots[item]; ok && item.Highlighted() {
+			if thumb := ml.thumbnail(slot); thumb != nil {
+				var (
+					bounds = ml.camera.WorldBounds
+				)
+				ml.text.Draw(thumb, bounds.Max.X()-float32(thumb.Width)-10, bounds.Max.Y()-float32(thumb.Height)-10)
+			}
+		}
+	}
+	if ml.message != "" {
+		ml.msgcache.SetText(ml.message)
+		if ml.msgcache.Texture != nil {
+			ml.text.Draw(ml.msgcache.Texture, 0, ml.camera.WorldBounds.Min.Y())
+		}
+	}
 	ml.text.Unbind()
 }
 
@@ -156,7 +386,10 @@ func (ml *MenuLayer) HandleEvent(evt twodee.Event) bool {
 				break
 			}
 			if event.Code == twodee.KeyEscape {
-				ml.menu.Reset()
+				if err := ml.rebuild(); err != nil {
+					fmt.Printf("Could not build menu: %v\n", err)
+					break
+				}
 				ml.visible = true
 			}
 		}
@@ -204,7 +437,9 @@ func (ml *MenuLayer) HandleEvent(evt twodee.Event) bool {
 		}
 		switch event.Code {
 		case twodee.KeyEscape:
-			ml.visible = false
+			if !ml.choosing {
+				ml.visible = false
+			}
 			return false
 		case twodee.KeyUp:
 			ml.menu.Prev()
@@ -218,6 +453,8 @@ func (ml *MenuLayer) HandleEvent(evt twodee.Event) bool {
 			}
 			return false
 		}
+		// The menu has the keyboard while it's up.
+		return false
 	}
 	return true
 }
@@ -230,9 +467,116 @@ func (ml *MenuLayer) handleMenuItem(data *twodee.MenuItemData) {
 			ml.state.Exit = true
 		case DebugCode:
 			ml.state.Debug = !ml.state.Debug
-			ml.visible = false
+			ml.app.SaveSettings()
+			ml.visible = ml.choosing
 		}
+	case OptionCode:
+		ml.setOption(data.Value)
+	case InfoCode:
+	case SlotContinueCode:
+		ml.play(ContinueGame, int(data.Value))
+	case SlotNewGameCode:
+		ml.play(NewGame, int(data.Value))
+	case SlotCopyCode:
+		var (
+			from = int(data.Value) / SaveSlots
+			to   = int(data.Value) % SaveSlots
+		)
+		if err := ml.app.CopySave(from, to); err != nil {
+			ml.message = fmt.Sprintf("Could not copy: %v", err)
+		}
+		ml.refresh()
+	case SlotDeleteCode:
+		if err := ml.app.DeleteSave(int(data.Value)); err != nil {
+			ml.message = fmt.Sprintf("Could not delete: %v", err)
+		}
+		ml.refresh()
 	default:
 		fmt.Printf("Menu entry selection: %v\n", data)
 	}
 }
+
+// play starts or continues a game in a slot and gets out of the way.
+func (ml *MenuLayer) play(t twodee.GameEventType, slot int) {
+	ml.app.GameEventHandler.Enqueue(NewSlotEvent(t, slot))
+	ml.message = ""
+	ml.choosing = false
+	ml.visible = false
+}
+
+// refresh rebuilds the menu after the slots change.
+func (ml *MenuLayer) refresh() {
+	if err := ml.rebuild(); err != nil {
+		fmt.Printf("Could not build menu: %v\n", err)
+		ml.visible = false
+		return
+	}
+	// Continue might be gone if its slot was emptied.
+	ml.choosing = ml.choosing && ml.app.CurrentSave() != nil
+}
+
+// setOption changes a setting, puts it into effect and saves it. The new
+// value is shown as the menu's message.
+func (ml *MenuLayer) setOption(option int32) {
+	var (
+		settings = ml.app.Settings
+		onOff    = map[bool]string{true: "on", false: "off"}
+	)
+	switch option {
+	case MusicOption:
+		ml.app.SetMusic(!settings.Music)
+		ml.message = fmt.Sprintf("Music %v", onOff[settings.Music])
+		return // Already saved.
+	case MasterUpOption:
+		settings.MasterVolume = clampVolume(settings.MasterVolume + VolumeStep)
+		ml.message = fmt.Sprintf("Master volume %v%%", settings.MasterVolume)
+	case MasterDownOption:
+		settings.MasterVolume = clampVolume(settings.MasterVolume - VolumeStep)
+		ml.message = fmt.Sprintf("Master volume %v%%", settings.MasterVolume)
+	case MusicUpOption:
+		settings.MusicVolume = clampVolume(settings.MusicVolume + VolumeStep)
+		ml.message = fmt.Sprintf("Music volume %v%%", settings.MusicVolume)
+	case MusicDownOption:
+		settings.MusicVolume = clampVolume(settings.MusicVolume - VolumeStep)
+		ml.message = fmt.Sprintf("Music volume %v%%", settings.MusicVolume)
+	case EffectsUpOption:
+		settings.EffectsVolume = clampVolume(settings.EffectsVolume + VolumeStep)
+		ml.message = fmt.Sprintf("Effects volume %v%%", settings.EffectsVolume)
+	case EffectsDownOption:
+		settings.EffectsVolume = clampVolume(settings.EffectsVolume - VolumeStep)
+		ml.message = fmt.Sprintf("Effects volume %v%%", settings.EffectsVolume)
+	case FullscreenOption:
+		settings.Fullscreen = !settings.Fullscreen
+		ml.message = fmt.Sprintf("Fullscreen %v after restart", onOff[settings.Fullscreen])
+	case WindowSizeOption:
+		next := 0
+		for i, size := range WindowSizes {
+			if size[0] == settings.WindowWidth && size[1] == settings.WindowHeight {
+				next = (i + 1) % len(WindowSizes)
+			}
+		}
+		settings.WindowWidth, settings.WindowHeight = WindowSizes[next][0], WindowSizes[next][1]
+		ml.message = fmt.Sprintf("Window %vx%v after restart", settings.WindowWidth, settings.WindowHeight)
+	case VSyncOption:
+		settings.VSync = !settings.VSync
+		ml.message = fmt.Sprintf("VSync %v", onOff[settings.VSync])
+	case ScreenShakeOption:
+		settings.Accessibility.ScreenShake = !settings.Accessibility.ScreenShake
+		ml.message = fmt.Sprintf("Screen shake %v", onOff[settings.Accessibility.ScreenShake])
+	case FlashingOption:
+		settings.Accessibility.ReduceFlashing = !settings.Accessibility.ReduceFlashing
+		ml.message = fmt.Sprintf("Reduce flashing %v", onOff[settings.Accessibility.ReduceFlashing])
+	case SpeedrunOption:
+		settings.SpeedrunTimer = !settings.SpeedrunTimer
+		ml.message = fmt.Sprintf("Speedrun timer %v from next new game", onOff[settings.SpeedrunTimer])
+	case OverwriteSettingsOption:
+		settings.Overwrite()
+		ml.message = "Settings saved"
+		ml.refresh()
+	}
+	ml.app.ApplySettings()
+	ml.app.SaveSettings()
+	if settings.Unreadable() {
+		ml.message = fmt.Sprintf("%v, not saved over unreadable settings", ml.message)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"./sdlmixer"
+)
+
+// Bus is a group of sounds whose volume is turned up or down together.
+type Bus int
+
+const (
+	// MasterBus sets the volume of everything.
+	MasterBus Bus = iota
+	MusicBus
+	EffectsBus
+	NumBuses
+)
+
+// mixedEffect is a sound effect with its own volume, from 0 to 1, before its
+// bus is applied.
+type mixedEffect struct {
+	effect *sdlmixer.Chunk
+	level  float32
+	bus    Bus
+}
+
+// Mixer works out how loud each sound plays from its own level and the
+// levels of the buses it goes through. The music and effect volumes are set
+// whenever a level changes, which also changes sounds already playing.
+type Mixer struct {
+	levels    [NumBuses]float32
+	musicFade [MusicChannels]float32
+	effects   []mixedEffect
+}
+
+func NewMixer() *Mixer {
+	m := &Mixer{}
+	for i := range m.levels {
+		m.levels[i] = 1
+	}
+	for i := range m.musicFade {
+		m.musicFade[i] = 1
+	}
+	return m
+}
+
+// AddEffect mixes effect into bus at level, from 0 to 1.
+func (m *Mixer) AddEffect(effect *sdlmixer.Chunk, level float32, bus Bus) {
+	m.effects = append(m.effects, mixedEffect{effect, level, bus})
+	m.applyEffect(m.effects[len(m.effects)-1])
+}
+
+// SetLevel sets the volume of bus from 0 to 100.
+func (m *Mixer) SetLevel(bus Bus, volume int) {
+	m.levels[bus] = float32(clampVolume(volume)) / 100
+	m.Apply()
+}
+
+// Level returns how loud bus plays, from 0 to 1, after the master bus.
+func (m *Mixer) Level(bus Bus) float32 {
+	if bus == MasterBus {
+		return m.levels[MasterBus]
+	}
+	return m.levels[bus] * m.levels[MasterBus]
+}
+
+// Volume returns the volume to play something at level on bus at.
+func (m *Mixer) Volume(level float32, bus Bus) int {
+	return int(MaxVolume * level * m.Level(bus))
+}
+
+// SetMusicFade turns the music on channel down to level, from 0 to 1, while
+// it fades in or out.
+func (m *Mixer) SetMusicFade(channel int, level float32) {
+	if level != m.musicFade[channel] {
+		m.musicFade[channel] = level
+		sdlmixer.SetVolume(channel, m.Volume(level, MusicBus))
+	}
+}
+
+// Apply sets the volume of the music and every effect.
+func (m *Mixer) Apply() {
+	for channel, fade := range m.musicFade {
+		sdlmixer.SetVolume(channel, m.Volume(fade, MusicBus))
+	}
+	for _, e := range m.effects {
+		m.applyEffect(e)
+	}
+}
+
+func (m *Mixer) applyEffect(e mixedEffect) {
+	e.effect.SetVolume(m.Volume(e.level, e.bus))
+}
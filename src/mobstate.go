@@ -16,8 +16,9 @@ package main
 
 import (
 	"../lib/twodee"
+	"encoding/json"
+	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
-	"math"
 	"time"
 )
 
@@ -31,13 +32,28 @@ type Mob interface {
 	Speed() float32
 	MoveTo(twodee.Point)
 	ShouldSwing(p mgl32.Vec2) bool
+	Allows(s MobStateMask) bool
+	LookAround() time.Duration
+	Fire(target mgl32.Vec2) *Projectile
 }
 
+// MobStateMask lists the states a mobile may enter of its own accord.
+type MobStateMask int32
+
+const (
+	_                          = iota
+	SearchAllowed MobStateMask = 1 << iota
+	HuntAllowed
+	InvestigateAllowed
+)
+
 type Mobile struct {
 	DetectionRadius float32
 	BoredThreshold  time.Duration
+	States          MobStateMask
 	speed           float32
 	searchPattern   []mgl32.Vec2
+	lookAround      time.Duration
 }
 
 func (m *Mobile) Bored(d time.Duration) bool {
@@ -56,6 +72,16 @@ func (m *Mobile) Speed() float32 {
 	return m.speed
 }
 
+func (m *Mobile) Allows(s MobStateMask) bool {
+	return m.States&s == s
+}
+
+// LookAround is how long the mobile searches around a spot it investigates
+// before giving up.
+func (m *Mobile) LookAround() time.Duration {
+	return m.lookAround
+}
+
 // TODO: this should probably just kill the player?
 func (m *Mobile) HandleCollision(p *Player) {}
 
@@ -90,6 +116,11 @@ type BaseState struct {
 	Name string
 }
 
+// String returns the name of the state.
+func (s *BaseState) String() string {
+	return s.Name
+}
+
 func (s *BaseState) ExamineWorld(m Mob, l *Level) MobState {
 	return s
 }
@@ -110,14 +141,17 @@ func NewVegState() *VegState {
 	return &VegState{&BaseState{"Veggie"}}
 }
 
-// ExamineWorld always returns a new SearchState.
+// ExamineWorld returns a new SearchState if the mob is allowed to search.
 func (s *VegState) ExamineWorld(m Mob, l *Level) MobState {
+	if !m.Allows(SearchAllowed) {
+		return s
+	}
 	return &SearchState{
 		Pattern:        m.SearchPattern(),
 		targetPointIdx: 0,
-		path:           []twodee.GridPoint{},
+		path:           nil,
 		pathIdx:        0,
-		pathAge:        maxPathAge,
+		routed:         false,
 		BaseState:      &BaseState{"Search"}}
 }
 
@@ -125,134 +159,120 @@ func (s *VegState) ExamineWorld(m Mob, l *Level) MobState {
 // hoping to chance across the player.
 // TODO: Implement Enter and Exit to have searching animations.
 type SearchState struct {
-	Pattern          []mgl32.Vec2
-	targetPointIdx   int
-	path             []twodee.GridPoint
-	pathIdx, pathAge int
+	Pattern        []mgl32.Vec2
+	targetPointIdx int
+	path           []mgl32.Vec2
+	pathIdx        int
+	routed         bool
 	*BaseState
 }
 
 // ExamineWorld returns HuntState if the player is seen, otherwise the mob
 // continues wandering according to its search pattern.
 func (s *SearchState) ExamineWorld(m Mob, l *Level) MobState {
-	s.pathAge++
-	g := l.BossCollisions
-	l.SetBossPath(s.path)
-	if playerSeen(m, l) {
-		return NewHuntState()
+	l.SetBossPath(s.path[s.pathIdx:])
+	if m.Allows(HuntAllowed) && playerSeen(m, l) {
+		return NewHuntState(l.Player.Pos().Vec2)
+	}
+	if n := noiseHeard(m, l); n != nil && m.Allows(InvestigateAllowed) {
+		return NewInvestigateState(n.Pos.Vec2, m.LookAround(), false)
 	}
 	if len(s.Pattern) == 0 {
 		// Do nothing right now with no search pattern.
 		return s
 	}
-	cTarget := s.Pattern[s.targetPointIdx]
-	if s.pathAge > maxPathAge {
-		if path := getPath(g, m.Pos(), twodee.Point{cTarget}); len(path) > 0 {
-			s.path = path
-			s.pathAge = 0
-			s.pathIdx = 0
-		}
-		// Otherwise retain current path.
-	}
-	if len(s.path) == 0 {
-		return s // Crap, still no path generated...
+	if !s.routed {
+		s.path = l.Pathfinder.Path(m.Pos().Vec2, s.Pattern[s.targetPointIdx])
+		s.pathIdx = 0
+		s.routed = true
 	}
-	mv := mgl32.Vec2{m.Pos().X(), m.Pos().Y()}
-	for s.pathIdx < len(s.path)-1 {
-		tv := mgl32.Vec2{
-			g.InversePosition(s.path[s.pathIdx].X, 0.5),
-			g.InversePosition(s.path[s.pathIdx].Y, 0.5),
-		}
-		if tv.Sub(mv).Len() >= 2 {
-			break
-		}
-		s.pathIdx++
-	}
-	tv := mgl32.Vec2{
-		g.InversePosition(s.path[s.pathIdx].X, 0.5),
-		g.InversePosition(s.path[s.pathIdx].Y, 0.5),
-	}
-	MoveMob(m, tv.Sub(mv).Normalize().Mul(m.Speed()), l)
-	if s.pathIdx == len(s.path)-1 && tv.Sub(mv).Len() < 2 {
+	if s.pathIdx = followPath(m, l, s.path, s.pathIdx); s.pathIdx == len(s.path) {
+		// Arrived, or the point can't be reached. Either way, move on.
 		s.targetPointIdx = (s.targetPointIdx + 1) % len(s.Pattern)
+		s.routed = false
 	}
 	return s
 }
 
-const maxPathAge = 2
+// maxTraceLength is how many steps along the flow field are shown as the
+// boss's path while it hunts.
+const maxTraceLength = 64
 
 // HuntState is the state during which a mobile is actively hunting the player.
 type HuntState struct {
 	durSinceLastContact time.Duration
-	path                []twodee.GridPoint
-	pathIdx, pathAge    int
+	lastSeen            mgl32.Vec2
+	investigated        bool
+	path                []mgl32.Vec2
+	pathIdx             int
+	routed              bool
 	*BaseState
 }
 
-func NewHuntState() *HuntState {
+func NewHuntState(lastSeen mgl32.Vec2) *HuntState {
 	return &HuntState{
 		durSinceLastContact: 0,
-		path:                []twodee.GridPoint{},
+		lastSeen:            lastSeen,
+		investigated:        false,
+		path:                nil,
 		pathIdx:             0,
-		pathAge:             maxPathAge,
+		routed:              false,
 		BaseState:           &BaseState{"Hunt"},
 	}
 }
 
 // ExamineWorld returns the current state if the player is currently seen or
-// the mob is not yet tired of chasing. Otherwise, it returns nil.
-func (s *HuntState) ExamineWorld(m Mob, l *Level) (ns MobState) {
-	s.pathAge++
-	g := l.BossCollisions
+// the mob is not yet tired of chasing. Otherwise, it returns nil. Mobs which
+// may investigate instead go check where the player was last seen when they
+// lose sight of them, and give up if that turns up nothing.
+//
+// While the player is seen the mob follows the level's shared flow field
+// toward them, or walks straight at them if nothing is in the way. Out of
+// sight, it heads for the spot the player was last seen.
+func (s *HuntState) ExamineWorld(m Mob, l *Level) MobState {
+	var (
+		mv = m.Pos().Vec2
+		pv = l.Player.Pos().Vec2
+	)
 	if playerSeen(m, l) {
-		// Try to generate a new path if the player is seen and our
-		// last one is stale.
-		if s.pathAge > maxPathAge {
-			if path := getPath(g, m.Pos(), l.Player.Pos()); len(path) > 0 {
-				s.path = path
-				s.pathAge = 0
-				s.pathIdx = 0
-			}
-			// Otherwise keep our current path, since we couldn't make
-			// a new one.
-		}
 		s.durSinceLastContact = time.Duration(0)
-		ns = s
-	}
-	l.SetBossPath(s.path)
-	if !m.Bored(s.durSinceLastContact) {
-		ns = s
-	}
-	if ns != nil {
-		pv := mgl32.Vec2{l.Player.Pos().X(), l.Player.Pos().Y()}
+		s.lastSeen = pv
+		s.investigated = false
+		s.routed = false
 		if m.ShouldSwing(pv) {
 			// Return Swing state.
 		}
-
-		// We've passed the end of the path; there's nothing left to do.
-		// Hopefully a new path will be generated within a few frames.
-		if s.pathIdx == len(s.path) {
-			return ns
-		}
-		mv := m.Pos().Vec2
-		for s.pathIdx < len(s.path)-1 { // Never roll off the end.
-			tv := mgl32.Vec2{
-				g.InversePosition(s.path[s.pathIdx].X, 0.5),
-				g.InversePosition(s.path[s.pathIdx].Y, 0.5),
-			}
-			if tv.Sub(mv).Len() >= 2 {
-				break
-			}
-			s.pathIdx++
+		if p := m.Fire(pv); p != nil {
+			l.SpawnProjectile(p)
 		}
 		// Chase player!
-		tv := mgl32.Vec2{
-			g.InversePosition(s.path[s.pathIdx].X, 0.5),
-			g.InversePosition(s.path[s.pathIdx].Y, 0.5),
+		if l.Pathfinder.Map.LineOfSight(mv, pv, l.Pathfinder.Radius) {
+			l.SetBossPath([]mgl32.Vec2{pv})
+			MoveMob(m, pv.Sub(mv).Normalize().Mul(m.Speed()), l)
+		} else if dir, ok := l.PlayerField.Direction(mv); ok {
+			l.SetBossPath(l.PlayerField.Trace(mv, maxTraceLength))
+			MoveMob(m, dir.Mul(m.Speed()), l)
 		}
-		MoveMob(m, tv.Sub(mv).Normalize().Mul(m.Speed()), l)
+		return s
+	}
+	if m.Allows(InvestigateAllowed) {
+		if s.investigated || m.Bored(s.durSinceLastContact) {
+			return nil
+		}
+		s.investigated = true
+		return NewInvestigateState(s.lastSeen, m.LookAround(), true)
+	}
+	if m.Bored(s.durSinceLastContact) {
+		return nil
+	}
+	if !s.routed {
+		s.path = l.Pathfinder.Path(mv, s.lastSeen)
+		s.pathIdx = 0
+		s.routed = true
 	}
-	return ns
+	s.pathIdx = followPath(m, l, s.path, s.pathIdx)
+	l.SetBossPath(s.path[s.pathIdx:])
+	return s
 }
 
 // Update resets the player's hiding timer if the player is seen, otherwise it
@@ -261,6 +281,124 @@ func (s *HuntState) Update(m Mob, d time.Duration) {
 	s.durSinceLastContact += d
 }
 
+// InvestigateState is the state during which a mobile walks toward something
+// it heard or the spot where it last saw the player, then looks around for a
+// while hoping to find the player there.
+type InvestigateState struct {
+	Target     mgl32.Vec2
+	LookAround time.Duration
+	looked     time.Duration
+	arrived    bool
+	resume     bool
+	path       []mgl32.Vec2
+	pathIdx    int
+	routed     bool
+	*BaseState
+}
+
+// NewInvestigateState returns a state which investigates target for
+// lookAround once it gets there. If resume is set, the state pops as soon as
+// the player is seen so that the state below can pick the chase back up.
+func NewInvestigateState(target mgl32.Vec2, lookAround time.Duration, resume bool) *InvestigateState {
+	return &InvestigateState{
+		Target:     target,
+		LookAround: lookAround,
+		looked:     0,
+		arrived:    false,
+		resume:     resume,
+		path:       nil,
+		pathIdx:    0,
+		routed:     false,
+		BaseState:  &BaseState{"Investigate"},
+	}
+}
+
+// lookOffsets are the spots around the target a mob paces between while
+// looking around.
+var lookOffsets = []mgl32.Vec2{
+	mgl32.Vec2{-1.5, 0},
+	mgl32.Vec2{0, 1.5},
+	mgl32.Vec2{1.5, 0},
+	mgl32.Vec2{0, -1.5},
+}
+
+// ExamineWorld returns HuntState (or nil, if resuming a hunt) if the player
+// is seen, and nil once the mob is done looking around the target. Hearing
+// another noise on the way changes the target.
+func (s *InvestigateState) ExamineWorld(m Mob, l *Level) MobState {
+	if playerSeen(m, l) {
+		if s.resume {
+			return nil
+		}
+		if m.Allows(HuntAllowed) {
+			return NewHuntState(l.Player.Pos().Vec2)
+		}
+	}
+	if n := noiseHeard(m, l); n != nil {
+		s.Target = n.Pos.Vec2
+		s.routed = false
+		s.arrived = false
+		s.looked = 0
+	}
+	if !s.routed {
+		s.path = l.Pathfinder.Path(m.Pos().Vec2, s.Target)
+		s.pathIdx = 0
+		s.routed = true
+	}
+	if !s.arrived {
+		s.pathIdx = followPath(m, l, s.path, s.pathIdx)
+		l.SetBossPath(s.path[s.pathIdx:])
+		// Unreachable targets are looked at from wherever the mob is.
+		s.arrived = s.pathIdx == len(s.path)
+		return s
+	}
+	if s.looked >= s.LookAround {
+		return nil
+	}
+	// Pace between the spots around the target.
+	i := int(int64(s.looked) * int64(len(lookOffsets)) / int64(s.LookAround))
+	tv := s.Target.Add(lookOffsets[i])
+	if dv := tv.Sub(m.Pos().Vec2); dv.Len() > 0.1 {
+		MoveMob(m, dv.Normalize().Mul(m.Speed()/2), l)
+	}
+	return s
+}
+
+// Update counts time spent looking around once the target is reached.
+func (s *InvestigateState) Update(m Mob, d time.Duration) {
+	if s.arrived {
+		s.looked += d
+	}
+}
+
+// StaggerState holds a mobile in place for a fixed duration, for example
+// while a boss is changing phase.
+type StaggerState struct {
+	Duration time.Duration
+	elapsed  time.Duration
+	*BaseState
+}
+
+func NewStaggerState(d time.Duration) *StaggerState {
+	return &StaggerState{
+		Duration:  d,
+		elapsed:   0,
+		BaseState: &BaseState{"Stagger"},
+	}
+}
+
+// ExamineWorld returns nil once the stagger has worn off.
+func (s *StaggerState) ExamineWorld(m Mob, l *Level) MobState {
+	if s.elapsed >= s.Duration {
+		return nil
+	}
+	return s
+}
+
+func (s *StaggerState) Update(m Mob, d time.Duration) {
+	s.elapsed += d
+}
+
 // playerSeen returns true if the player is currently visible to the mob and
 // within its detection radius.
 func playerSeen(m Mob, l *Level) bool {
@@ -273,50 +411,35 @@ func playerSeen(m Mob, l *Level) bool {
 	return false
 }
 
-// getPath maps the provided start and end "world" coordinations into discrete
-// grid-space, then runs A* search. The resultant slice is also in discrete
-// grid-space, since portions of this slice may be thrown away. Calling
-// code should therefore map back to "world" coordinates for use when moving.
-func getPath(g *twodee.Grid, s, e twodee.Point) []twodee.GridPoint {
-	// Need to map from points in the game to locations on the grid board.
-	sx, sy := g.GridPosition(s.X(), 0.5), g.GridPosition(s.Y(), 0.5)
-	ex, ey := g.GridPosition(e.X(), 0.5), g.GridPosition(e.Y(), 0.5)
-	path, err := g.GetPath(sx, sy, ex, ey)
-	if err != nil {
-		if g.Get(sx, sy) { // Crap, we're inside of something. cheat!
-			for _, sp := range neighbors(sx, sy) {
-				sx, sy = sp.X, sp.Y
-				if !g.Get(sx, sy) {
-
-					//					fmt.Printf("Trying position (%v, %v) to (%v, %v)\n", sx, sy, ex, ey)
-					if path, err := g.GetPath(sx, sy, ex, ey); err != nil {
-						//						fmt.Printf("Shaken free with %v\n", path)
-						return path
-					}
-				}
-			}
-			//			fmt.Printf("Still stuck, perhaps we should rand move.\n")
+// noiseHeard returns the closest noise the mob heard since the last update,
+// or nil if it heard nothing.
+func noiseHeard(m Mob, l *Level) (heard *NoiseEvent) {
+	var (
+		mpv  = m.Pos().Vec2
+		best float32
+	)
+	for _, n := range l.Noises {
+		d := n.Pos.Vec2.Sub(mpv).Len()
+		if d <= n.Radius && (heard == nil || d < best) {
+			heard = n
+			best = d
 		}
-		return []twodee.GridPoint{}
 	}
-	return path
+	return
 }
 
-func neighbors(x, y int32) []twodee.GridPoint {
-	searchSize := 4
-	r := make([]twodee.GridPoint, 0, int(math.Pow(float64(searchSize), 2.0))-1)
-	for dx := -searchSize; dx <= searchSize; dx++ {
-		for dy := -searchSize; dy <= searchSize; dy++ {
-			if dx == 0 && dy == 0 {
-				continue
-			}
-			r = append(r, twodee.GridPoint{int32(dx), int32(dy)})
-		}
+// followPath moves the mob toward path[idx], moving on to the next waypoint
+// once it is within a step of the current one. Returns the new index, which is
+// len(path) once the end is reached.
+func followPath(m Mob, l *Level, path []mgl32.Vec2, idx int) int {
+	mv := m.Pos().Vec2
+	for idx < len(path) && path[idx].Sub(mv).Len() <= m.Speed() {
+		idx++
 	}
-	for i, o := range r {
-		r[i] = twodee.GridPoint{x + o.X, y + o.Y}
+	if idx < len(path) {
+		MoveMob(m, path[idx].Sub(mv).Normalize().Mul(m.Speed()), l)
 	}
-	return r
+	return idx
 }
 
 func MaxInt(x, y int) int {
@@ -325,3 +448,218 @@ func MaxInt(x, y int) int {
 	}
 	return y
 }
+
+// mobStates makes empty MobStates by name so that a saved StateStack can be
+// read back. States are saved with encoding/json, so a state whose progress
+// lives in unexported fields needs MarshalJSON and UnmarshalJSON.
+var mobStates = map[string]func() MobState{}
+
+// RegisterMobState lets states named name be saved and loaded. f returns an
+// empty state to load into.
+func RegisterMobState(name string, f func() MobState) {
+	mobStates[name] = f
+}
+
+func init() {
+	RegisterMobState("Veggie", func() MobState {
+		return NewVegState()
+	})
+	RegisterMobState("Search", func() MobState {
+		return &SearchState{BaseState: &BaseState{"Search"}}
+	})
+	RegisterMobState("Hunt", func() MobState {
+		return NewHuntState(mgl32.Vec2{})
+	})
+	RegisterMobState("Investigate", func() MobState {
+		return NewInvestigateState(mgl32.Vec2{}, 0, false)
+	})
+	RegisterMobState("Stagger", func() MobState {
+		return NewStaggerState(0)
+	})
+}
+
+// SavedMobState is a single entry of a saved StateStack.
+type SavedMobState struct {
+	Name  string          `json:"name"`
+	State json.RawMessage `json:"state"`
+}
+
+// SaveMobStates marshals every state in stack, bottom first.
+func SaveMobStates(stack []MobState) (saved []SavedMobState, err error) {
+	for _, state := range stack {
+		var (
+			data  []byte
+			named fmt.Stringer
+			ok    bool
+		)
+		if named, ok = state.(fmt.Stringer); !ok {
+			return nil, fmt.Errorf("Can't save unnamed state %T", state)
+		}
+		if _, ok = mobStates[named.String()]; !ok {
+			return nil, fmt.Errorf("State %v is not registered", named)
+		}
+		if data, err = json.Marshal(state); err != nil {
+			return nil, err
+		}
+		saved = append(saved, SavedMobState{Name: named.String(), State: data})
+	}
+	return
+}
+
+// LoadMobStates rebuilds a StateStack saved by SaveMobStates.
+func LoadMobStates(saved []SavedMobState) (stack []MobState, err error) {
+	for _, s := range saved {
+		f, ok := mobStates[s.Name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown state %v", s.Name)
+		}
+		state := f()
+		if err = json.Unmarshal(s.State, state); err != nil {
+			return nil, fmt.Errorf("State %v: %v", s.Name, err)
+		}
+		stack = append(stack, state)
+	}
+	return
+}
+
+// CopyMobStates copies every state in stack, bottom first, so that the copy
+// can be put back later without going through encoding/json. States never
+// change their paths or patterns in place, so those are shared.
+func CopyMobStates(stack []MobState) (copied []MobState, err error) {
+	copied = make([]MobState, 0, len(stack))
+	for _, state := range stack {
+		switch s := state.(type) {
+		case *VegState:
+			c := *s
+			copied = append(copied, &c)
+		case *SearchState:
+			c := *s
+			copied = append(copied, &c)
+		case *HuntState:
+			c := *s
+			copied = append(copied, &c)
+		case *InvestigateState:
+			c := *s
+			copied = append(copied, &c)
+		case *StaggerState:
+			c := *s
+			copied = append(copied, &c)
+		default:
+			return nil, fmt.Errorf("Can't copy state %T", state)
+		}
+	}
+	return
+}
+
+// savedRoute is how far along its path a state which walks one has got.
+type savedRoute struct {
+	Path    []mgl32.Vec2 `json:"path"`
+	PathIdx int          `json:"path_idx"`
+	Routed  bool         `json:"routed"`
+}
+
+type savedSearchState struct {
+	Pattern []mgl32.Vec2 `json:"pattern"`
+	Target  int          `json:"target"`
+	savedRoute
+}
+
+func (s *SearchState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(savedSearchState{
+		Pattern:    s.Pattern,
+		Target:     s.targetPointIdx,
+		savedRoute: savedRoute{s.path, s.pathIdx, s.routed},
+	})
+}
+
+func (s *SearchState) UnmarshalJSON(data []byte) (err error) {
+	var saved savedSearchState
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return
+	}
+	s.Pattern = saved.Pattern
+	s.targetPointIdx = saved.Target
+	s.path, s.pathIdx, s.routed = saved.Path, saved.PathIdx, saved.Routed
+	return
+}
+
+type savedHuntState struct {
+	SinceContact time.Duration `json:"since_contact"`
+	LastSeen     mgl32.Vec2    `json:"last_seen"`
+	Investigated bool          `json:"investigated"`
+	savedRoute
+}
+
+func (s *HuntState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(savedHuntState{
+		SinceContact: s.durSinceLastContact,
+		LastSeen:     s.lastSeen,
+		Investigated: s.investigated,
+		savedRoute:   savedRoute{s.path, s.pathIdx, s.routed},
+	})
+}
+
+func (s *HuntState) UnmarshalJSON(data []byte) (err error) {
+	var saved savedHuntState
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return
+	}
+	s.durSinceLastContact = saved.SinceContact
+	s.lastSeen = saved.LastSeen
+	s.investigated = saved.Investigated
+	s.path, s.pathIdx, s.routed = saved.Path, saved.PathIdx, saved.Routed
+	return
+}
+
+type savedInvestigateState struct {
+	Target     mgl32.Vec2    `json:"target"`
+	LookAround time.Duration `json:"look_around"`
+	Looked     time.Duration `json:"looked"`
+	Arrived    bool          `json:"arrived"`
+	Resume     bool          `json:"resume"`
+	savedRoute
+}
+
+func (s *InvestigateState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(savedInvestigateState{
+		Target:     s.Target,
+		LookAround: s.LookAround,
+		Looked:     s.looked,
+		Arrived:    s.arrived,
+		Resume:     s.resume,
+		savedRoute: savedRoute{s.path, s.pathIdx, s.routed},
+	})
+}
+
+func (s *InvestigateState) UnmarshalJSON(data []byte) (err error) {
+	var saved savedInvestigateState
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return
+	}
+	s.Target = saved.Target
+	s.LookAround = saved.LookAround
+	s.looked = saved.Looked
+	s.arrived = saved.Arrived
+	s.resume = saved.Resume
+	s.path, s.pathIdx, s.routed = saved.Path, saved.PathIdx, saved.Routed
+	return
+}
+
+type savedStaggerState struct {
+	Duration time.Duration `json:"duration"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+func (s *StaggerState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(savedStaggerState{s.Duration, s.elapsed})
+}
+
+func (s *StaggerState) UnmarshalJSON(data []byte) (err error) {
+	var saved savedStaggerState
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return
+	}
+	s.Duration = saved.Duration
+	s.elapsed = saved.Elapsed
+	return
+}
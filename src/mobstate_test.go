@@ -0,0 +1,141 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-gl/mathgl/mgl32"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// savedStates has a state partway through its work for every registered
+// name.
+func savedStates() map[string]MobState {
+	var (
+		path   = []mgl32.Vec2{{1, 2}, {3, 4}, {5, 6}}
+		search = &SearchState{
+			Pattern:        []mgl32.Vec2{{0, 0}, {8, 0}},
+			targetPointIdx: 1,
+			path:           path,
+			pathIdx:        2,
+			routed:         true,
+			BaseState:      &BaseState{"Search"},
+		}
+		hunt        = NewHuntState(mgl32.Vec2{7, 8})
+		investigate = NewInvestigateState(mgl32.Vec2{9, 10}, 3*time.Second, true)
+		stagger     = NewStaggerState(1500 * time.Millisecond)
+	)
+	hunt.durSinceLastContact = 750 * time.Millisecond
+	hunt.investigated = true
+	hunt.path, hunt.pathIdx, hunt.routed = path, 1, true
+	investigate.looked = time.Second
+	investigate.arrived = true
+	investigate.path, investigate.pathIdx, investigate.routed = path, 3, true
+	stagger.elapsed = 400 * time.Millisecond
+	return map[string]MobState{
+		"Veggie":      NewVegState(),
+		"Search":      search,
+		"Hunt":        hunt,
+		"Investigate": investigate,
+		"Stagger":     stagger,
+	}
+}
+
+func TestMobStatesSaveLoad(t *testing.T) {
+	var (
+		states = savedStates()
+	)
+	for name := range mobStates {
+		state, ok := states[name]
+		if !ok {
+			t.Fatalf("No test state for %v", name)
+		}
+		saved, err := SaveMobStates([]MobState{state})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved[0].Name != name {
+			t.Fatalf("Saved %v as %v", name, saved[0].Name)
+		}
+		loaded, err := LoadMobStates(saved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded[0], state) {
+			t.Fatalf("Loaded %+v, saved %+v", loaded[0], state)
+		}
+	}
+}
+
+func TestLevelSnapshotJSON(t *testing.T) {
+	var (
+		states = savedStates()
+		s      = &LevelSnapshot{
+			Level: "boss1",
+			Color: mgl32.Vec3{0.5, 0, 1},
+			Player: PlayerSnapshot{
+				Pos:       mgl32.Vec2{3, 4},
+				State:     Walking | Left,
+				Frame:     2,
+				Running:   true,
+				StepTimer: 100 * time.Millisecond,
+				Aiming:    true,
+				Aim:       mgl32.Vec2{0, 1},
+				Charge:    mgl32.Vec3{1, 0, 0},
+				Charged:   true,
+			},
+			Plates: []PlateSnapshot{
+				{Active: true, Elapsed: time.Second},
+				{Drained: true},
+			},
+			Boss: &BossSnapshot{
+				Pos:        mgl32.Vec2{10, 5},
+				Color:      mgl32.Vec3{0, 1, 0},
+				Phase:      1,
+				Current:    BossPhase{Color: mgl32.Vec3{0, 1, 0}, Speed: 0.05, SearchPattern: []mgl32.Vec2{{1, 1}}},
+				Colors:     []BossPhase{{Color: mgl32.Vec3{0, 0, 1}, FireRate: 2 * time.Second}},
+				SinceFired: 300 * time.Millisecond,
+			},
+			Projectiles: []ProjectileSnapshot{{
+				Pos:      mgl32.Vec2{1, 1},
+				Velocity: mgl32.Vec2{0.1, 0},
+				Lifetime: 2 * time.Second,
+				Color:    mgl32.Vec3{1, 1, 0},
+				Owner:    BossProjectile,
+				Elapsed:  500 * time.Millisecond,
+			}},
+		}
+		loaded LevelSnapshot
+		err    error
+		data   []byte
+	)
+	if s.Boss.States, err = SaveMobStates([]MobState{states["Veggie"], states["Hunt"], states["Stagger"]}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = json.Marshal(s); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&loaded, s) {
+		t.Fatalf("Loaded %+v, saved %+v", loaded, s)
+	}
+	if _, err = LoadMobStates(loaded.Boss.States); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"./sdlmixer"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	// MusicConfigPath is the file which says what music each level plays.
+	MusicConfigPath = "resources/music.json"
+	// MusicChannels is how many mixer channels, from the first, the music
+	// plays on: one for the track playing and one for the track fading out
+	// under it.
+	MusicChannels = 2
+)
+
+// MusicTrack is a piece of music from the music file.
+type MusicTrack struct {
+	Path string `json:"path"`
+	// Length is how long the track is in seconds, where it loops back to
+	// the start. Zero loops at the end of the file.
+	Length float64 `json:"length"`
+	// Resume picks the track up from where it stopped the next time it
+	// plays, rather than from the start.
+	Resume bool `json:"resume,omitempty"`
+	// Sections split the track into loops tagged by intensity. Only the
+	// section for the current intensity plays.
+	Sections []MusicSection `json:"sections,omitempty"`
+	// SwitchFade is how many seconds to crossfade over when switching
+	// sections.
+	SwitchFade float64 `json:"switch_fade,omitempty"`
+}
+
+// LevelMusic is the track a level plays, and how many seconds to crossfade
+// into it from the last track. Fade defaults to the music file's fade. Intensity picks which of the track's sections play.
+type LevelMusic struct {
+	Track     string          `json:"track"`
+	Fade      *float64        `json:"fade,omitempty"`
+	Intensity []IntensityRule `json:"intensity,omitempty"`
+}
+
+// MusicConfig is the music file. Levels it doesn't list keep playing
+// whatever was already playing.
+type MusicConfig struct {
+	Fade   float64                `json:"fade"`
+	Tracks map[string]*MusicTrack `json:"tracks"`
+	Levels map[string]LevelMusic  `json:"levels"`
+}
+
+// LoadMusicConfig reads the music file at path.
+func LoadMusicConfig(path string) (c *MusicConfig, err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	c = &MusicConfig{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("Music file is corrupt: %v", err)
+	}
+	for level, music := range c.Levels {
+		if _, ok := c.Tracks[music.Track]; !ok {
+			return nil, fmt.Errorf("Level %v plays unknown track %v", level, music.Track)
+		}
+	}
+	for name, track := range c.Tracks {
+		for _, section := range track.Sections {
+			if section.End <= section.Start {
+				return nil, fmt.Errorf("Track %v has a section ending before it starts", name)
+			}
+		}
+	}
+	return
+}
+
+// seconds converts a time in seconds from the music file.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// musicVoice is a track playing on one of the music channels.
+type musicVoice struct {
+	track   string
+	section int
+	// loop is the part of the track from start to end which repeats,
+	// rotated to begin where the voice started playing. It's nil while the
+	// voice isn't playing.
+	loop  *sdlmixer.Chunk
+	start time.Duration
+	end   time.Duration
+	level float32
+	// fadingOut is set on a voice on its way out under the current one.
+	fadingOut bool
+	// from is how far into the track the voice was when its clock was
+	// last set, at startedAt. The clock runs in real time while the voice
+	// plays, so that it keeps pace with the music through level loads and
+	// slow updates.
+	from      time.Duration
+	startedAt time.Time
+	running   bool
+}
+
+// wrap returns where pos falls in the voice's loop.
+func (v *musicVoice) wrap(pos time.Duration) time.Duration {
+	switch {
+	case v.end <= v.start || pos < v.start:
+		return v.start
+	case pos >= v.end:
+		return v.start + (pos-v.start)%(v.end-v.start)
+	}
+	return pos
+}
+
+// at returns how far into its track the voice is.
+func (v *musicVoice) at() time.Duration {
+	pos := v.from
+	if v.running {
+		pos += time.Since(v.startedAt)
+	}
+	return v.wrap(pos)
+}
+
+// hold stops the voice's clock where it is.
+func (v *musicVoice) hold() {
+	v.from = v.at()
+	v.running = false
+}
+
+// run starts the voice's clock from where it was held.
+func (v *musicVoice) run() {
+	v.startedAt = time.Now()
+	v.running = true
+}
+
+// MusicPlayer plays the music for each level, crossfading from the last
+// track into the next. Both play at once, on the two MusicChannels, with the
+// outgoing track fading out while the incoming one fades in.
+type MusicPlayer struct {
+	// On is false while the player has the music turned off.
+	On     bool
+	config *MusicConfig
+	mixer  *Mixer
+	music  map[string]*sdlmixer.Chunk
+	// voices plays on the music channel of the same index. current is the
+	// voice with the current track, the other is fading out or silent.
+	voices    [MusicChannels]musicVoice
+	current   int
+	fade      time.Duration
+	rules     []IntensityRule
+	intensity int
+	// position is where each track which resumes stopped.
+	position map[string]time.Duration
+}
+
+// NewMusicPlayer loads every track in config, fading the music through
+// mixer.
+func NewMusicPlayer(config *MusicConfig, mixer *Mixer, on bool) (p *MusicPlayer, err error) {
+	p = &MusicPlayer{
+		On:       on,
+		config:   config,
+		mixer:    mixer,
+		music:    map[string]*sdlmixer.Chunk{},
+		position: map[string]time.Duration{},
+	}
+	for i := range p.voices {
+		p.voices[i].section = -1
+	}
+	for name, track := range config.Tracks {
+		var music *sdlmixer.Chunk
+		if music, err = sdlmixer.LoadChunk(track.Path); err != nil {
+			p.Delete()
+			return nil, err
+		}
+		p.music[name] = music
+	}
+	return
+}
+
+func (p *MusicPlayer) Delete() {
+	for i := range p.voices {
+		p.stop(i)
+	}
+	for _, music := range p.music {
+		music.Delete()
+	}
+}
+
+// PlayLevel crossfades to the music for level.
+func (p *MusicPlayer) PlayLevel(level string) {
+	var (
+		music LevelMusic
+		ok    bool
+		fade  = p.config.Fade
+	)
+	if music, ok = p.config.Levels[level]; !ok {
+		return
+	}
+	if music.Fade != nil {
+		fade = *music.Fade
+	}
+	p.rules = music.Intensity
+	p.Play(music.Track, seconds(fade))
+}
+
+// Play crossfades from the current track into track over fade. Tracks which
+// resume start from where they stopped.
+func (p *MusicPlayer) Play(track string, fade time.Duration) {
+	if track == p.voices[p.current].track {
+		return
+	}
+	p.crossfade(track, p.sectionFor(track, p.intensity), p.position[track], fade)
+}
+
+// SetOn turns the music on or off. Turning it back on carries on from where
+// it was turned off.
+func (p *MusicPlayer) SetOn(on bool) {
+	p.On = on
+	for i := range p.voices {
+		v := &p.voices[i]
+		switch {
+		case !on && v.running:
+			v.hold()
+			sdlmixer.Pause(i)
+		case on && v.loop != nil && !v.running:
+			sdlmixer.Resume(i)
+			v.run()
+		case on && v.loop == nil:
+			// The level changed while the music was off.
+			p.play(i)
+		}
+	}
+}
+
+// Update moves the crossfade along. Fades wait while the music is off.
+func (p *MusicPlayer) Update(elapsed time.Duration) {
+	var (
+		step = float32(1)
+	)
+	if !p.On {
+		return
+	}
+	if p.fade > 0 {
+		step = float32(elapsed) / float32(p.fade)
+	}
+	for i := range p.voices {
+		v := &p.voices[i]
+		switch {
+		case v.track == "":
+			continue
+		case v.fadingOut:
+			if v.level -= step; v.level <= 0 {
+				p.stop(i)
+				continue
+			}
+		case v.level < 1:
+			if v.level += step; v.level > 1 {
+				v.level = 1
+			}
+		}
+		p.mixer.SetMusicFade(i, v.level)
+	}
+}
+
+// crossfade fades out of the current voice over fade while section of track
+// fades in from pos on the other. If that's what the other voice is already
+// fading out of, it fades back in from where it is instead. Without a fade,
+// or while the music is off, the switch is immediate.
+func (p *MusicPlayer) crossfade(track string, section int, pos, fade time.Duration) {
+	var (
+		next = 1 - p.current
+		in   = &p.voices[next]
+		out  = &p.voices[p.current]
+	)
+	p.fade = fade
+	if in.track != track || in.section != section || in.loop == nil {
+		p.stop(next)
+		in.track, in.section = track, section
+		in.start, in.end = p.loopOf(track, section)
+		in.from = in.wrap(pos)
+		if p.On {
+			p.play(next)
+		}
+	}
+	in.fadingOut = false
+	out.fadingOut = true
+	p.current = next
+	if fade <= 0 || !p.On {
+		p.stop(1 - next)
+		in.level = 1
+	}
+	p.mixer.SetMusicFade(next, in.level)
+}
+
+// loopOf returns the part of track which loops while section plays, or the
+// whole track if it has no sections.
+func (p *MusicPlayer) loopOf(track string, section int) (start, end time.Duration) {
+	var (
+		t = p.config.Tracks[track]
+	)
+	if section >= 0 {
+		return seconds(t.Sections[section].Start), seconds(t.Sections[section].End)
+	}
+	if t.Length > 0 {
+		return 0, seconds(t.Length)
+	}
+	length, err := p.music[track].Length()
+	if err != nil {
+		fmt.Printf("Could not find the length of %v: %v\n", track, err)
+	}
+	return 0, seconds(length)
+}
+
+// play starts voice i looping from where its clock says.
+func (p *MusicPlayer) play(i int) {
+	var (
+		v   = &p.voices[i]
+		err error
+	)
+	if v.track == "" {
+		return
+	}
+	if v.loop, err = p.music[v.track].Loop(v.start.Seconds(), v.end.Seconds(), v.at().Seconds()); err != nil {
+		fmt.Printf("Could not loop %v: %v\n", v.track, err)
+		return
+	}
+	p.mixer.SetMusicFade(i, v.level)
+	if err = v.loop.PlayLooping(i); err != nil {
+		fmt.Printf("Could not play %v: %v\n", v.track, err)
+		v.loop.Delete()
+		v.loop = nil
+		return
+	}
+	v.run()
+}
+
+// stop silences voice i, remembering where its track got to if it resumes.
+func (p *MusicPlayer) stop(i int) {
+	v := &p.voices[i]
+	if v.track == "" {
+		return
+	}
+	if track := p.config.Tracks[v.track]; track != nil && track.Resume {
+		p.position[v.track] = v.at()
+	} else {
+		delete(p.position, v.track)
+	}
+	if v.loop != nil {
+		sdlmixer.Halt(i)
+		v.loop.Delete()
+	}
+	*v = musicVoice{section: -1}
+}
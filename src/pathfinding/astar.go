@@ -0,0 +1,116 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathfinding
+
+import (
+	"container/heap"
+)
+
+type openNode struct {
+	index    int32
+	priority int32
+}
+
+type openList []openNode
+
+func (l openList) Len() int            { return len(l) }
+func (l openList) Less(i, j int) bool  { return l[i].priority < l[j].priority }
+func (l openList) Swap(i, j int)       { l[i], l[j] = l[j], l[i] }
+func (l *openList) Push(x interface{}) { *l = append(*l, x.(openNode)) }
+func (l *openList) Pop() interface{} {
+	old := *l
+	n := old[len(old)-1]
+	*l = old[:len(old)-1]
+	return n
+}
+
+// octile estimates the cost of moving between two cells with eight way
+// movement.
+func octile(a, b Cell) int32 {
+	dx, dy := a.X-b.X, a.Y-b.Y
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	if dx < dy {
+		dx, dy = dy, dx
+	}
+	return 10*(dx-dy) + 14*dy
+}
+
+// FindPath runs A* from start to goal and returns every cell along the way,
+// both ends included. Returns nil if there is no path.
+func (m *Map) FindPath(start, goal Cell) []Cell {
+	if m.Blocked(start) || m.Blocked(goal) {
+		return nil
+	}
+	m.search++
+	var (
+		open = &openList{}
+		si   = m.index(start)
+		gi   = m.index(goal)
+	)
+	m.seen[si] = m.search
+	m.cost[si] = 0
+	m.from[si] = -1
+	heap.Push(open, openNode{si, octile(start, goal)})
+	for open.Len() > 0 {
+		node := heap.Pop(open).(openNode)
+		if m.done[node.index] == m.search {
+			continue // Stale entry for a cell we found a better way to.
+		}
+		m.done[node.index] = m.search
+		if node.index == gi {
+			return m.walkBack(gi)
+		}
+		c := m.cell(node.index)
+		for _, o := range neighborOffsets {
+			if !m.canStep(c, o.dx, o.dy) {
+				continue
+			}
+			var (
+				n    = Cell{c.X + o.dx, c.Y + o.dy}
+				ni   = m.index(n)
+				cost = m.cost[node.index] + o.cost
+			)
+			if m.done[ni] == m.search {
+				continue
+			}
+			if m.seen[ni] == m.search && m.cost[ni] <= cost {
+				continue
+			}
+			m.seen[ni] = m.search
+			m.cost[ni] = cost
+			m.from[ni] = node.index
+			heap.Push(open, openNode{ni, cost + octile(n, goal)})
+		}
+	}
+	return nil
+}
+
+func (m *Map) walkBack(i int32) []Cell {
+	var n = 0
+	for j := i; j != -1; j = m.from[j] {
+		n++
+	}
+	path := make([]Cell, n)
+	for j := i; j != -1; j = m.from[j] {
+		n--
+		path[n] = m.cell(j)
+	}
+	return path
+}
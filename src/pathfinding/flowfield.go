@@ -0,0 +1,153 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathfinding
+
+import (
+	"container/heap"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// unreachable is the cost of cells with no path to the goal.
+const unreachable = int32(-1)
+
+// FlowField holds the cost of reaching a single goal from every cell of a
+// Map. Any number of mobs can share one field to head toward the same goal.
+type FlowField struct {
+	m     *Map
+	goal  Cell
+	valid bool
+	cost  []int32
+}
+
+func NewFlowField(m *Map) *FlowField {
+	return &FlowField{
+		m:    m,
+		cost: make([]int32, m.Width*m.Height),
+	}
+}
+
+// SetGoal points the field at the world position v. The field is only
+// rebuilt when v is in a different cell from the current goal.
+func (f *FlowField) SetGoal(v mgl32.Vec2) {
+	goal, ok := f.m.NearestOpen(f.m.CellAt(v), unstickRadius)
+	if !ok || (f.valid && goal == f.goal) {
+		return
+	}
+	f.goal = goal
+	f.valid = true
+	f.build()
+}
+
+// Goal returns the cell the field currently leads to.
+func (f *FlowField) Goal() Cell {
+	return f.goal
+}
+
+// build runs Dijkstra outward from the goal.
+func (f *FlowField) build() {
+	for i := range f.cost {
+		f.cost[i] = unreachable
+	}
+	var (
+		open = &openList{}
+		gi   = f.m.index(f.goal)
+	)
+	f.cost[gi] = 0
+	heap.Push(open, openNode{gi, 0})
+	for open.Len() > 0 {
+		node := heap.Pop(open).(openNode)
+		if node.priority > f.cost[node.index] {
+			continue // Stale entry.
+		}
+		c := f.m.cell(node.index)
+		for _, o := range neighborOffsets {
+			if !f.m.canStep(c, o.dx, o.dy) {
+				continue
+			}
+			var (
+				ni   = f.m.index(Cell{c.X + o.dx, c.Y + o.dy})
+				cost = node.priority + o.cost
+			)
+			if f.cost[ni] != unreachable && f.cost[ni] <= cost {
+				continue
+			}
+			f.cost[ni] = cost
+			heap.Push(open, openNode{ni, cost})
+		}
+	}
+}
+
+// Cost returns the cost of reaching the goal from c, or -1 if it cannot be
+// reached.
+func (f *FlowField) Cost(c Cell) int32 {
+	if !f.valid || f.m.Blocked(c) {
+		return unreachable
+	}
+	return f.cost[f.m.index(c)]
+}
+
+// next returns the neighbor of c which is closest to the goal.
+func (f *FlowField) next(c Cell) (best Cell, ok bool) {
+	bestCost := f.Cost(c)
+	if bestCost <= 0 {
+		return c, false
+	}
+	for _, o := range neighborOffsets {
+		if !f.m.canStep(c, o.dx, o.dy) {
+			continue
+		}
+		n := Cell{c.X + o.dx, c.Y + o.dy}
+		if cost := f.Cost(n); cost != unreachable && cost < bestCost {
+			best, bestCost, ok = n, cost, true
+		}
+	}
+	return
+}
+
+// Direction returns the normalized direction to move from the world position
+// v in order to follow the field. Returns false if v is at the goal or has no
+// way of reaching it.
+func (f *FlowField) Direction(v mgl32.Vec2) (mgl32.Vec2, bool) {
+	c, ok := f.m.NearestOpen(f.m.CellAt(v), unstickRadius)
+	if !ok {
+		return mgl32.Vec2{}, false
+	}
+	n, ok := f.next(c)
+	if !ok {
+		return mgl32.Vec2{}, false
+	}
+	d := f.m.Center(n).Sub(v)
+	if d.Len() == 0 {
+		return mgl32.Vec2{}, false
+	}
+	return d.Normalize(), true
+}
+
+// Trace follows the field from the world position v for at most max steps
+// and returns the centers of the cells visited.
+func (f *FlowField) Trace(v mgl32.Vec2, max int) []mgl32.Vec2 {
+	c, ok := f.m.NearestOpen(f.m.CellAt(v), unstickRadius)
+	if !ok {
+		return nil
+	}
+	out := []mgl32.Vec2{}
+	for i := 0; i < max; i++ {
+		if c, ok = f.next(c); !ok {
+			break
+		}
+		out = append(out, f.m.Center(c))
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pathfinding finds smoothed paths and flow fields across a
+// collision grid.
+package pathfinding
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Grid is the collision data paths are found on. Get returns true for
+// blocked cells. GridPosition and InversePosition convert between world
+// coordinates and cells, and are satisfied by twodee.Grid.
+type Grid interface {
+	Get(x, y int32) bool
+	GridPosition(v float32, ratio float32) int32
+	InversePosition(i int32, ratio float32) float32
+}
+
+// Cell is a discrete position on a Grid.
+type Cell struct {
+	X, Y int32
+}
+
+// Map wraps a Grid with its dimensions and the scratch space used for
+// searches. A Map is not safe for concurrent use.
+type Map struct {
+	grid     Grid
+	Width    int32
+	Height   int32
+	CellSize float32
+	cost     []int32
+	from     []int32
+	seen     []uint32
+	done     []uint32
+	search   uint32
+}
+
+// NewMap returns a Map over a grid of w by h cells, each of which is
+// cellSize world units across.
+func NewMap(g Grid, w, h int32, cellSize float32) *Map {
+	n := int(w * h)
+	return &Map{
+		grid:     g,
+		Width:    w,
+		Height:   h,
+		CellSize: cellSize,
+		cost:     make([]int32, n),
+		from:     make([]int32, n),
+		seen:     make([]uint32, n),
+		done:     make([]uint32, n),
+	}
+}
+
+// Blocked returns true if the cell is solid or off the map.
+func (m *Map) Blocked(c Cell) bool {
+	if c.X < 0 || c.Y < 0 || c.X >= m.Width || c.Y >= m.Height {
+		return true
+	}
+	return m.grid.Get(c.X, c.Y)
+}
+
+// CellAt returns the cell containing the world position v.
+func (m *Map) CellAt(v mgl32.Vec2) Cell {
+	return Cell{
+		m.grid.GridPosition(v[0], m.CellSize),
+		m.grid.GridPosition(v[1], m.CellSize),
+	}
+}
+
+// Center returns the world position of the middle of c.
+func (m *Map) Center(c Cell) mgl32.Vec2 {
+	return mgl32.Vec2{
+		m.grid.InversePosition(c.X, m.CellSize),
+		m.grid.InversePosition(c.Y, m.CellSize),
+	}
+}
+
+// NearestOpen returns the closest unblocked cell within radius cells of c,
+// for when a mob has wandered inside of something.
+func (m *Map) NearestOpen(c Cell, radius int32) (Cell, bool) {
+	if !m.Blocked(c) {
+		return c, true
+	}
+	for r := int32(1); r <= radius; r++ {
+		for dx := -r; dx <= r; dx++ {
+			for dy := -r; dy <= r; dy++ {
+				if dx != -r && dx != r && dy != -r && dy != r {
+					continue // Only check the ring at distance r.
+				}
+				n := Cell{c.X + dx, c.Y + dy}
+				if !m.Blocked(n) {
+					return n, true
+				}
+			}
+		}
+	}
+	return c, false
+}
+
+// LineOfSight returns true if a body of the given radius can travel in a
+// straight line from a to b without touching a blocked cell.
+func (m *Map) LineOfSight(a, b mgl32.Vec2, radius float32) bool {
+	var (
+		d = b.Sub(a)
+		n = mgl32.Vec2{-d[1], d[0]}
+	)
+	if n.Len() > 0 {
+		n = n.Normalize().Mul(radius)
+	}
+	return m.clearLine(a, b) &&
+		m.clearLine(a.Add(n), b.Add(n)) &&
+		m.clearLine(a.Sub(n), b.Sub(n))
+}
+
+// clearLine samples the segment from a to b every quarter cell.
+func (m *Map) clearLine(a, b mgl32.Vec2) bool {
+	var (
+		d     = b.Sub(a)
+		steps = int(math.Ceil(float64(d.Len() / (m.CellSize / 4))))
+	)
+	for i := 0; i <= steps; i++ {
+		t := float32(1)
+		if steps > 0 {
+			t = float32(i) / float32(steps)
+		}
+		if m.Blocked(m.CellAt(a.Add(d.Mul(t)))) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Map) index(c Cell) int32 {
+	return c.Y*m.Width + c.X
+}
+
+func (m *Map) cell(i int32) Cell {
+	return Cell{i % m.Width, i / m.Width}
+}
+
+// neighborOffsets lists the eight directions a path may step in along with
+// the cost of doing so.
+var neighborOffsets = []struct {
+	dx, dy, cost int32
+}{
+	{1, 0, 10}, {-1, 0, 10}, {0, 1, 10}, {0, -1, 10},
+	{1, 1, 14}, {1, -1, 14}, {-1, 1, 14}, {-1, -1, 14},
+}
+
+// canStep returns true if a body may move from c by (dx, dy). Diagonal moves
+// may not cut the corners of blocked cells.
+func (m *Map) canStep(c Cell, dx, dy int32) bool {
+	if m.Blocked(Cell{c.X + dx, c.Y + dy}) {
+		return false
+	}
+	if dx != 0 && dy != 0 {
+		return !m.Blocked(Cell{c.X + dx, c.Y}) && !m.Blocked(Cell{c.X, c.Y + dy})
+	}
+	return true
+}
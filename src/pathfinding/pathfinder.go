@@ -0,0 +1,136 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathfinding
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// unstickRadius is how many cells around a blocked start or goal are
+// searched for an open cell.
+const unstickRadius = 4
+
+// Smooth string-pulls a cell path into the fewest waypoints that a body of
+// the given radius can walk between in straight lines. The first waypoint is
+// the center of the first cell.
+func (m *Map) Smooth(path []Cell, radius float32) []mgl32.Vec2 {
+	if len(path) == 0 {
+		return nil
+	}
+	var (
+		out    = []mgl32.Vec2{m.Center(path[0])}
+		anchor = 0
+	)
+	for anchor < len(path)-1 {
+		var (
+			from = m.Center(path[anchor])
+			next = anchor + 1
+		)
+		for next+1 < len(path) && m.LineOfSight(from, m.Center(path[next+1]), radius) {
+			next++
+		}
+		out = append(out, m.Center(path[next]))
+		anchor = next
+	}
+	return out
+}
+
+type cacheKey struct {
+	start, goal Cell
+}
+
+// PathCache remembers smoothed paths by their start and goal cells. Once
+// full, the oldest entries are evicted first.
+type PathCache struct {
+	max     int
+	entries map[cacheKey][]mgl32.Vec2
+	order   []cacheKey
+	Hits    int
+	Misses  int
+}
+
+func NewPathCache(max int) *PathCache {
+	return &PathCache{
+		max:     max,
+		entries: map[cacheKey][]mgl32.Vec2{},
+		order:   make([]cacheKey, 0, max),
+	}
+}
+
+func (c *PathCache) get(k cacheKey) (path []mgl32.Vec2, ok bool) {
+	if path, ok = c.entries[k]; ok {
+		c.Hits++
+	} else {
+		c.Misses++
+	}
+	return
+}
+
+func (c *PathCache) put(k cacheKey, path []mgl32.Vec2) {
+	if c.max <= 0 {
+		return
+	}
+	if len(c.order) >= c.max {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[k] = path
+	c.order = append(c.order, k)
+}
+
+// Clear empties the cache, for example when the grid changes.
+func (c *PathCache) Clear() {
+	c.entries = map[cacheKey][]mgl32.Vec2{}
+	c.order = c.order[:0]
+}
+
+// Pathfinder finds smoothed, cached paths for bodies of a fixed radius.
+type Pathfinder struct {
+	Map    *Map
+	Cache  *PathCache
+	Radius float32
+}
+
+func NewPathfinder(m *Map, radius float32, cacheSize int) *Pathfinder {
+	return &Pathfinder{
+		Map:    m,
+		Cache:  NewPathCache(cacheSize),
+		Radius: radius,
+	}
+}
+
+// Path returns the waypoints to walk from one world position to another,
+// not including the starting cell. Starts or goals inside of something are
+// moved to the nearest open cell. Returns nil if there is no path. The
+// returned slice is shared with the cache and must not be modified.
+func (p *Pathfinder) Path(from, to mgl32.Vec2) []mgl32.Vec2 {
+	var (
+		start, sok = p.Map.NearestOpen(p.Map.CellAt(from), unstickRadius)
+		goal, gok  = p.Map.NearestOpen(p.Map.CellAt(to), unstickRadius)
+		key        = cacheKey{start, goal}
+	)
+	if !sok || !gok {
+		return nil
+	}
+	if path, ok := p.Cache.get(key); ok {
+		return path
+	}
+	var path []mgl32.Vec2
+	if cells := p.Map.FindPath(start, goal); cells != nil {
+		path = p.Map.Smooth(cells, p.Radius)[1:]
+	}
+	p.Cache.put(key, path)
+	return path
+}
@@ -0,0 +1,220 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathfinding
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"github.com/go-gl/mathgl/mgl32"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testGrid is a minimal collision grid loaded from a TMX layer.
+type testGrid struct {
+	width, height int32
+	blocked       []bool
+}
+
+func (g *testGrid) Get(x, y int32) bool {
+	return g.blocked[y*g.width+x]
+}
+
+func (g *testGrid) GridPosition(v float32, ratio float32) int32 {
+	return int32(math.Floor(float64(v / ratio)))
+}
+
+func (g *testGrid) InversePosition(i int32, ratio float32) float32 {
+	return float32(i)*ratio + ratio/2.0
+}
+
+type tmxFile struct {
+	Layers []struct {
+		Name   string `xml:"name,attr"`
+		Width  int32  `xml:"width,attr"`
+		Height int32  `xml:"height,attr"`
+		Data   string `xml:"data"`
+	} `xml:"layer"`
+}
+
+// loadLayer reads a base64, zlib compressed TMX layer into a testGrid.
+func loadLayer(tb testing.TB, path, layer string) *testGrid {
+	var (
+		data []byte
+		tmx  tmxFile
+		err  error
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		tb.Fatal(err)
+	}
+	if err = xml.Unmarshal(data, &tmx); err != nil {
+		tb.Fatal(err)
+	}
+	for _, l := range tmx.Layers {
+		if l.Name != layer {
+			continue
+		}
+		var (
+			raw  []byte
+			r    io.ReadCloser
+			gids = make([]uint32, l.Width*l.Height)
+			g    = &testGrid{l.Width, l.Height, make([]bool, l.Width*l.Height)}
+		)
+		if raw, err = base64.StdEncoding.DecodeString(strings.TrimSpace(l.Data)); err != nil {
+			tb.Fatal(err)
+		}
+		if r, err = zlib.NewReader(bytes.NewReader(raw)); err != nil {
+			tb.Fatal(err)
+		}
+		if err = binary.Read(r, binary.LittleEndian, gids); err != nil {
+			tb.Fatal(err)
+		}
+		for i, gid := range gids {
+			g.blocked[i] = gid != 0
+		}
+		return g
+	}
+	tb.Fatalf("No layer %v in %v", layer, path)
+	return nil
+}
+
+func loadMainMap(tb testing.TB) *Map {
+	g := loadLayer(tb, "../resources/main.tmx", "collision")
+	return NewMap(g, g.width, g.height, 0.5)
+}
+
+// Across the shrine from its west wall, in line with the pillars, so that the
+// path has to find its way around two of them.
+var (
+	benchStart = mgl32.Vec2{12.2, 21.7}
+	benchGoal  = mgl32.Vec2{25.2, 21.7}
+)
+
+func TestFindPathAvoidsWalls(t *testing.T) {
+	m := loadMainMap(t)
+	path := m.FindPath(m.CellAt(benchStart), m.CellAt(benchGoal))
+	if len(path) == 0 {
+		t.Fatalf("Expected a path")
+	}
+	for _, c := range path {
+		if m.Blocked(c) {
+			t.Fatalf("Path goes through blocked cell %v", c)
+		}
+	}
+}
+
+func TestSmoothKeepsLineOfSight(t *testing.T) {
+	var (
+		m      = loadMainMap(t)
+		cells  = m.FindPath(m.CellAt(benchStart), m.CellAt(benchGoal))
+		smooth = m.Smooth(cells, 0.4)
+	)
+	if len(smooth) >= len(cells) {
+		t.Fatalf("Expected fewer waypoints than cells, got %v >= %v", len(smooth), len(cells))
+	}
+	// Neighboring cells are kept even if the body would brush a wall, so
+	// only check that the line itself stays clear.
+	for i := 1; i < len(smooth); i++ {
+		if !m.LineOfSight(smooth[i-1], smooth[i], 0) {
+			t.Fatalf("No line of sight between waypoints %v and %v", i-1, i)
+		}
+	}
+}
+
+func TestFlowFieldReachesGoal(t *testing.T) {
+	var (
+		m = loadMainMap(t)
+		f = NewFlowField(m)
+	)
+	f.SetGoal(benchGoal)
+	trace := f.Trace(benchStart, int(m.Width*m.Height))
+	if len(trace) == 0 || m.CellAt(trace[len(trace)-1]) != f.Goal() {
+		t.Fatalf("Trace did not reach goal")
+	}
+}
+
+func TestPathCacheHits(t *testing.T) {
+	p := NewPathfinder(loadMainMap(t), 0.4, 16)
+	p.Path(benchStart, benchGoal)
+	p.Path(benchStart, benchGoal)
+	if p.Cache.Hits != 1 || p.Cache.Misses != 1 {
+		t.Fatalf("Expected 1 hit and 1 miss, got %v and %v", p.Cache.Hits, p.Cache.Misses)
+	}
+}
+
+func BenchmarkFindPath(b *testing.B) {
+	var (
+		m     = loadMainMap(b)
+		start = m.CellAt(benchStart)
+		goal  = m.CellAt(benchGoal)
+	)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.FindPath(start, goal)
+	}
+}
+
+func BenchmarkFindAndSmoothPath(b *testing.B) {
+	var (
+		m     = loadMainMap(b)
+		start = m.CellAt(benchStart)
+		goal  = m.CellAt(benchGoal)
+	)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Smooth(m.FindPath(start, goal), 0.4)
+	}
+}
+
+func BenchmarkCachedPath(b *testing.B) {
+	p := NewPathfinder(loadMainMap(b), 0.4, 16)
+	p.Path(benchStart, benchGoal)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Path(benchStart, benchGoal)
+	}
+}
+
+func BenchmarkFlowFieldBuild(b *testing.B) {
+	var (
+		m = loadMainMap(b)
+		f = NewFlowField(m)
+	)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.valid = false
+		f.SetGoal(benchGoal)
+	}
+}
+
+// BenchmarkFlowFieldSteer measures many mobs sharing one field, compared to
+// each running its own search.
+func BenchmarkFlowFieldSteer(b *testing.B) {
+	var (
+		m = loadMainMap(b)
+		f = NewFlowField(m)
+	)
+	f.SetGoal(benchGoal)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Direction(benchStart)
+	}
+}
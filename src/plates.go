@@ -20,15 +20,26 @@ import (
 	"time"
 )
 
+const (
+	// PlateNoiseRadius is how far away mobs can hear a plate being pressed.
+	PlateNoiseRadius = 12
+	// PlateActiveTime is how long a pressed plate adds its color.
+	PlateActiveTime = 5 * time.Second
+	// PlateDrainTime is how long a plate stays dark after the player
+	// absorbs its color.
+	PlateDrainTime = 5 * time.Second
+)
+
 type Plate struct {
 	Prop
 	Color   mgl32.Vec4
 	Active  bool
-	events  *twodee.GameEventHandler
+	Drained bool
+	events  *EventBus
 	elapsed time.Duration
 }
 
-func NewPlate(x, y float32, color mgl32.Vec3, sheet *twodee.Spritesheet, events *twodee.GameEventHandler) *Plate {
+func NewPlate(x, y float32, color mgl32.Vec3, sheet *twodee.Spritesheet, events *EventBus) *Plate {
 	return &Plate{
 		Prop: NewStaticProp(
 			x, y,
@@ -42,29 +53,73 @@ func NewPlate(x, y float32, color mgl32.Vec3, sheet *twodee.Spritesheet, events
 
 func (p *Plate) SpriteConfig(sheet *twodee.Spritesheet) twodee.SpriteConfig {
 	c := p.Prop.SpriteConfig(sheet)
-	if !p.Active {
-		c.Color = p.Color
-	} else {
+	switch {
+	case p.Drained:
+		c.Color = mgl32.Vec4{0.0, 0.0, 0.0, 0.5}
+	case p.Active:
 		c.Color = mgl32.Vec4{0.0, 0.0, 0.0, 1.0}
+	default:
+		c.Color = p.Color
 	}
 	return c
 }
 
 func (p *Plate) Update(elapsed time.Duration) {
+	switch {
+	case p.Drained:
+		p.elapsed += elapsed
+		if p.elapsed > PlateDrainTime {
+			p.Drained = false
+		}
+	case p.Active:
+		p.elapsed += elapsed
+		if p.elapsed > PlateActiveTime {
+			p.events.Enqueue(NewColorEvent(p.Color.Vec3(), false))
+			p.events.Enqueue(NewSoundEvent(PlayColorChangeEffect, p.Bounds().Midpoint()))
+			p.Active = false
+		}
+	}
+}
+
+// Drain takes the color of an active plate out of the level so that the
+// player can carry it as a charge. Returns false if the plate isn't active.
+func (p *Plate) Drain() (color mgl32.Vec3, ok bool) {
 	if !p.Active {
 		return
 	}
-	p.elapsed += elapsed
-	if p.elapsed > time.Duration(5)*time.Second {
-		p.events.Enqueue(NewColorEvent(p.Color.Vec3(), false))
-		p.Active = false
-	}
+	p.events.Enqueue(NewColorEvent(p.Color.Vec3(), false))
+	p.events.Enqueue(NewSoundEvent(PlayColorChangeEffect, p.Bounds().Midpoint()))
+	p.Active = false
+	p.Drained = true
+	p.elapsed = time.Duration(0)
+	return p.Color.Vec3(), true
 }
 
 func (p *Plate) HandleCollision(player *Player) {
-	if !p.Active {
+	if !p.Active && !p.Drained {
 		p.Active = true
 		p.events.Enqueue(NewColorEvent(p.Color.Vec3(), true))
+		p.events.Enqueue(NewSoundEvent(PlayColorChangeEffect, p.Bounds().Midpoint()))
+		p.events.Enqueue(NewNoiseEvent(p.Bounds().Midpoint(), PlateNoiseRadius))
 		p.elapsed = time.Duration(0)
 	}
 }
+
+// PlateSnapshot is the state of a plate at a given moment.
+type PlateSnapshot struct {
+	Active  bool          `json:"active"`
+	Drained bool          `json:"drained"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+func (p *Plate) Snapshot() PlateSnapshot {
+	return PlateSnapshot{p.Active, p.Drained, p.elapsed}
+}
+
+// Restore puts the plate back the way it was when s was captured. The
+// level's color is restored separately, so no color events are sent.
+func (p *Plate) Restore(s PlateSnapshot) {
+	p.Active = s.Active
+	p.Drained = s.Drained
+	p.elapsed = s.Elapsed
+}
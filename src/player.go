@@ -52,21 +52,44 @@ var PlayerAnimations = map[PlayerState][]int{
 	Dying:            []int{24, 24, 24, 25, 25, 25, 26, 26, 26, 27, 27, 27, 27, 27, 27},
 }
 
+const (
+	// RollNoiseRadius is how far away mobs can hear the player roll.
+	RollNoiseRadius = 8
+	// RunNoiseRadius is how far away mobs can hear the player's footsteps
+	// while running. Walking is silent.
+	RunNoiseRadius = 6
+	// RunNoiseInterval is the time between footstep noises while running.
+	RunNoiseInterval = 300 * time.Millisecond
+	// ChargeSpeed is how far a thrown color charge travels each update.
+	ChargeSpeed = 0.2
+	// ChargeLifetime is how long a thrown color charge flies.
+	ChargeLifetime = 1500 * time.Millisecond
+)
+
 type Player struct {
 	*twodee.AnimatingEntity
-	events    *twodee.GameEventHandler
+	events    *EventBus
 	dx        float32
 	dy        float32
 	rolldx    float32
 	rolldy    float32
 	speed     float32
+	runspeed  float32
 	rollspeed float32
 	rolling   bool
+	running   bool
+	stepTimer time.Duration
+	aiming    bool
+	aim       mgl32.Vec2
+	absorb    bool
+	throw     bool
+	Charge    mgl32.Vec3
+	Charged   bool
 	State     PlayerState
 	Dead      bool
 }
 
-func NewPlayer(events *twodee.GameEventHandler, sheet *twodee.Spritesheet) *Player {
+func NewPlayer(events *EventBus, sheet *twodee.Spritesheet) *Player {
 	var (
 		frame = sheet.GetFrame("player_00")
 	)
@@ -82,8 +105,12 @@ func NewPlayer(events *twodee.GameEventHandler, sheet *twodee.Spritesheet) *Play
 		dx:        0.0,
 		dy:        0.0,
 		speed:     0.05,
+		runspeed:  0.075,
 		rollspeed: 0.10,
 		rolling:   false,
+		running:   false,
+		aim:       mgl32.Vec2{0, 1},
+		Charged:   false,
 		Dead:      false,
 		State:     Standing | Up,
 	}
@@ -120,36 +147,57 @@ func (p *Player) UpdateLevel(elapsed time.Duration, level *Level) {
 		var (
 			isMoving = p.dx != 0 || p.dy != 0
 		)
+		if isMoving && !p.rolling {
+			p.aim = mgl32.Vec2{p.dx, p.dy}.Normalize()
+		}
+		if p.aiming && !p.rolling {
+			// Stand still and turn to face the aim.
+			isMoving = false
+		}
+		p.handleCharge(level)
 		if !p.rolling && isMoving {
-			var (
-				magX = math.Abs(float64(p.dx))
-				magY = math.Abs(float64(p.dy))
-			)
 			p.swapState(Rolling|Standing, Walking)
-			if magX > magY {
-				if p.dx > 0 {
-					p.swapState(Left|Up|Down, Right)
-				} else {
-					p.swapState(Up|Right|Down, Left)
-				}
+			p.face(p.dx, p.dy)
+			if p.running {
+				p.move(mgl32.Vec2{p.dx, p.dy}.Normalize().Mul(p.runspeed), level)
+				p.updateFootsteps(elapsed)
 			} else {
-				if p.dy > 0 {
-					p.swapState(Left|Right|Down, Up)
-				} else {
-					p.swapState(Left|Up|Right, Down)
-				}
+				p.move(mgl32.Vec2{p.dx, p.dy}.Normalize().Mul(p.speed), level)
 			}
-			p.move(mgl32.Vec2{p.dx, p.dy}.Normalize().Mul(p.speed), level)
 		} else if p.rolling && isMoving {
 			p.swapState(Walking|Standing, Rolling)
 			p.move(mgl32.Vec2{p.rolldx, p.rolldy}.Normalize().Mul(p.rollspeed), level)
 		} else {
 			p.swapState(Rolling|Walking, Standing)
+			if p.aiming {
+				p.face(p.aim[0], p.aim[1])
+			}
 		}
 	}
 	p.AnimatingEntity.Update(elapsed)
 }
 
+// face turns the player toward the larger component of (x, y).
+func (p *Player) face(x, y float32) {
+	var (
+		magX = math.Abs(float64(x))
+		magY = math.Abs(float64(y))
+	)
+	if magX > magY {
+		if x > 0 {
+			p.swapState(Left|Up|Down, Right)
+		} else {
+			p.swapState(Up|Right|Down, Left)
+		}
+	} else {
+		if y > 0 {
+			p.swapState(Left|Right|Down, Up)
+		} else {
+			p.swapState(Left|Up|Right, Down)
+		}
+	}
+}
+
 func (p *Player) move(vec mgl32.Vec2, level *Level) {
 	var (
 		bounds = p.Bounds()
@@ -164,6 +212,65 @@ func (p *Player) move(vec mgl32.Vec2, level *Level) {
 	p.MoveTo(twodee.Pt(pos.X()+vec[0], pos.Y()+vec[1]))
 }
 
+// handleCharge absorbs or throws a color charge if the player asked to.
+func (p *Player) handleCharge(level *Level) {
+	if p.absorb && !p.Charged {
+		bounds := p.Bounds()
+		for _, prop := range level.Plates {
+			if plate, ok := prop.(*Plate); ok && plate.Bounds().Overlaps(bounds) {
+				if p.Charge, p.Charged = plate.Drain(); p.Charged {
+					break
+				}
+			}
+		}
+	} else if p.throw && p.Charged {
+		level.SpawnProjectile(NewProjectile(
+			p.Pos().Vec2,
+			p.aim.Mul(ChargeSpeed),
+			ChargeLifetime,
+			p.Charge,
+			PlayerProjectile,
+			level.chargeHit,
+		))
+		p.Charged = false
+	}
+	p.absorb = false
+	p.throw = false
+}
+
+// Aiming returns whether the player is aiming, and in which direction.
+func (p *Player) Aiming() (bool, mgl32.Vec2) {
+	return p.aiming, p.aim
+}
+
+// Aim holds the player in place so that the movement controls only turn
+// them, for lining up a throw.
+func (p *Player) Aim(aiming bool) {
+	p.aiming = aiming
+}
+
+// UseCharge throws the player's color charge if they are carrying one, or
+// else absorbs the color of the plate they are standing on.
+func (p *Player) UseCharge() {
+	if p.Dead {
+		return
+	}
+	if p.Charged {
+		p.throw = true
+	} else {
+		p.absorb = true
+	}
+}
+
+// updateFootsteps emits a noise every RunNoiseInterval while running.
+func (p *Player) updateFootsteps(elapsed time.Duration) {
+	p.stepTimer += elapsed
+	if p.stepTimer >= RunNoiseInterval {
+		p.stepTimer -= RunNoiseInterval
+		p.events.Enqueue(NewNoiseEvent(p.Pos(), RunNoiseRadius))
+	}
+}
+
 func (p *Player) MoveX(mag float32) {
 	p.dx = mag
 }
@@ -172,6 +279,14 @@ func (p *Player) MoveY(mag float32) {
 	p.dy = mag
 }
 
+// Run makes the player move faster, at the cost of making noise.
+func (p *Player) Run(running bool) {
+	if running && !p.running {
+		p.stepTimer = RunNoiseInterval // First step is heard immediately.
+	}
+	p.running = running
+}
+
 func (p *Player) Die() {
 	if !p.Dead {
 		p.Dead = true
@@ -187,12 +302,16 @@ func (p *Player) Roll() {
 	p.rolling = true
 	p.rolldx = p.dx
 	p.rolldy = p.dy
-	p.SetCallback(func() {
-		p.swapState(Walking|Rolling, Standing)
-		p.rolling = false
-	})
+	p.SetCallback(p.endRoll)
 	p.events.Enqueue(NewShakeEvent(0, 500, 0.08, 4.0, 1.0))
 	p.events.Enqueue(twodee.NewBasicGameEvent(PlayRollEffect))
+	p.events.Enqueue(NewNoiseEvent(p.Pos(), RollNoiseRadius))
+}
+
+// endRoll is called once the roll animation finishes.
+func (p *Player) endRoll() {
+	p.swapState(Walking|Rolling, Standing)
+	p.rolling = false
 }
 
 func (p *Player) remState(state PlayerState) {
@@ -215,3 +334,79 @@ func (p *Player) setState(state PlayerState) {
 		}
 	}
 }
+
+// PlayerSnapshot is everything about the player that carries over from one
+// update to the next.
+type PlayerSnapshot struct {
+	Pos       mgl32.Vec2    `json:"pos"`
+	State     PlayerState   `json:"state"`
+	Frame     int           `json:"frame"`
+	Rolling   bool          `json:"rolling"`
+	RollDir   mgl32.Vec2    `json:"roll_dir"`
+	Running   bool          `json:"running"`
+	StepTimer time.Duration `json:"step_timer"`
+	Aiming    bool          `json:"aiming"`
+	Aim       mgl32.Vec2    `json:"aim"`
+	Charge    mgl32.Vec3    `json:"charge"`
+	Charged   bool          `json:"charged"`
+}
+
+// Snapshot captures the player. Dead players can't be captured.
+func (p *Player) Snapshot() (s PlayerSnapshot, err error) {
+	if p.Dead {
+		return s, fmt.Errorf("Player is dead")
+	}
+	return PlayerSnapshot{
+		Pos:       p.Pos().Vec2,
+		State:     p.State,
+		Frame:     p.Frame(),
+		Rolling:   p.rolling,
+		RollDir:   mgl32.Vec2{p.rolldx, p.rolldy},
+		Running:   p.running,
+		StepTimer: p.stepTimer,
+		Aiming:    p.aiming,
+		Aim:       p.aim,
+		Charge:    p.Charge,
+		Charged:   p.Charged,
+	}, nil
+}
+
+// Restore puts the player back the way they were when s was captured.
+func (p *Player) Restore(s PlayerSnapshot) {
+	p.MoveTo(twodee.Pt(s.Pos[0], s.Pos[1]))
+	p.rolling = s.Rolling
+	p.rolldx, p.rolldy = s.RollDir[0], s.RollDir[1]
+	p.running = s.Running
+	p.stepTimer = s.StepTimer
+	p.aiming = s.Aiming
+	p.aim = s.Aim
+	p.Charge = s.Charge
+	p.Charged = s.Charged
+	p.Dead = false
+	p.State = s.State
+	p.resumeAnimation(s.Frame)
+}
+
+// resumeAnimation plays the animation for the player's state starting from
+// frame. A roll picks up partway through and still ends on time; other
+// animations loop, so they just start at a different point.
+func (p *Player) resumeAnimation(frame int) {
+	frames := PlayerAnimations[p.State]
+	for i, f := range frames {
+		if f != frame {
+			continue
+		}
+		if p.rolling {
+			frames = frames[i:]
+		} else {
+			frames = append(append([]int{}, frames[i:]...), frames[:i]...)
+		}
+		break
+	}
+	p.SetFrames(frames)
+	if p.rolling {
+		p.SetCallback(p.endRoll)
+	} else {
+		p.SetCallback(nil)
+	}
+}
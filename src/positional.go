@@ -0,0 +1,91 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"./sdlmixer"
+	"fmt"
+	"math"
+)
+
+const (
+	// SoundRange is how far away, in world units, a positioned sound can
+	// be heard from the middle of the camera, unless its sound bank entry
+	// says otherwise.
+	SoundRange = 30
+	// SoundFull is how much of a sound's range it's heard at full volume.
+	SoundFull = 0.25
+)
+
+// Placement is how a positioned sound is heard: Gain from 0 to 1 and Pan
+// from -1, all the way left, to 1, all the way right.
+type Placement struct {
+	Gain float32
+	Pan  float32
+}
+
+// Listener hears positioned sounds from the middle of the camera.
+type Listener struct {
+	Bounds twodee.Rectangle
+}
+
+// Place works out how a sound at pos is heard. Sounds within SoundFull of
+// rng play at full volume, falling off to nothing at rng. Anything as far
+// to the side as the edge of the screen is panned all the way over.
+func (l *Listener) Place(pos twodee.Point, rng float32) (p Placement) {
+	var (
+		mid   = l.Bounds.Midpoint()
+		rel   = pos.Vec2.Sub(mid.Vec2)
+		dist  = rel.Len()
+		full  = rng * SoundFull
+		halfw = (l.Bounds.Max.X() - l.Bounds.Min.X()) / 2
+	)
+	switch {
+	case dist <= full:
+		p.Gain = 1
+	case dist < rng:
+		p.Gain = 1 - (dist-full)/(rng-full)
+	}
+	if halfw > 0 {
+		p.Pan = float32(math.Max(-1, math.Min(1, float64(rel.X()/halfw))))
+	}
+	return
+}
+
+// apply sets up channel to play the sound as placed. A nil placement plays
+// it evenly in both ears at full volume.
+func (p *Placement) apply(channel int) {
+	var (
+		left     = float32(255)
+		right    = float32(255)
+		distance uint8
+		err      error
+	)
+	if p != nil {
+		if p.Pan > 0 {
+			left = 255 * (1 - p.Pan)
+		} else {
+			right = 255 * (1 + p.Pan)
+		}
+		distance = uint8(255 * (1 - p.Gain))
+	}
+	if err = sdlmixer.SetPanning(channel, uint8(left), uint8(right)); err == nil {
+		err = sdlmixer.SetDistance(channel, distance)
+	}
+	if err != nil {
+		fmt.Printf("Could not place sound: %v\n", err)
+	}
+}
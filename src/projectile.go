@@ -0,0 +1,172 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"github.com/go-gl/mathgl/mgl32"
+	"time"
+)
+
+// ProjectileOwner determines what a projectile is able to hit.
+type ProjectileOwner int32
+
+const (
+	// PlayerProjectile hits bosses.
+	PlayerProjectile ProjectileOwner = iota
+	// BossProjectile hits the player.
+	BossProjectile
+)
+
+// ProjectileHitHandler is called when a projectile hits something. target is
+// nil if the projectile hit a wall.
+type ProjectileHitHandler func(p *Projectile, target Prop)
+
+type Projectile struct {
+	twodee.Entity
+	// Velocity is in units per update.
+	Velocity mgl32.Vec2
+	Lifetime time.Duration
+	Color    mgl32.Vec3
+	Owner    ProjectileOwner
+	OnHit    ProjectileHitHandler
+	Dead     bool
+	elapsed  time.Duration
+}
+
+func NewProjectile(pos, velocity mgl32.Vec2, lifetime time.Duration, color mgl32.Vec3, owner ProjectileOwner, onHit ProjectileHitHandler) *Projectile {
+	return &Projectile{
+		Entity:   twodee.NewBaseEntity(pos[0], pos[1], 0.5, 0.5, 0.0, 0),
+		Velocity: velocity,
+		Lifetime: lifetime,
+		Color:    color,
+		Owner:    owner,
+		OnHit:    onHit,
+		Dead:     false,
+	}
+}
+
+// Update moves the projectile and expires it once its lifetime is up or it
+// runs into a wall.
+func (p *Projectile) Update(elapsed time.Duration, level *Level) {
+	if p.Dead {
+		return
+	}
+	p.elapsed += elapsed
+	if p.elapsed >= p.Lifetime {
+		p.Dead = true
+		return
+	}
+	var (
+		bounds = p.Bounds()
+		pos    = p.Pos()
+		vec    = level.Collisions.FixMove(mgl32.Vec4{
+			bounds.Min.X(),
+			bounds.Min.Y(),
+			bounds.Max.X(),
+			bounds.Max.Y(),
+		}, p.Velocity, 0.5, 0.5)
+	)
+	p.MoveTo(twodee.Pt(pos.X()+vec[0], pos.Y()+vec[1]))
+	if vec != p.Velocity {
+		p.Hit(nil)
+	}
+}
+
+// Hit kills the projectile and calls its hit handler.
+func (p *Projectile) Hit(target Prop) {
+	if p.Dead {
+		return
+	}
+	p.Dead = true
+	if p.OnHit != nil {
+		p.OnHit(p, target)
+	}
+}
+
+func (p *Projectile) SpriteConfig(sheet *twodee.Spritesheet) twodee.SpriteConfig {
+	var (
+		pos = p.Pos()
+	)
+	return twodee.SpriteConfig{
+		View: twodee.ModelViewConfig{
+			pos.X(), pos.Y(), 0,
+			0, 0, 0,
+			0.5, 0.5, 1.0,
+		},
+		Frame: sheet.GetFrame("plate.fw").Frame,
+		Color: p.Color.Vec4(1.0),
+	}
+}
+
+type ProjectileList []*Projectile
+
+// Update moves every projectile, resolves hits against the player and the
+// boss and drops projectiles which are done.
+func (l ProjectileList) Update(elapsed time.Duration, level *Level) ProjectileList {
+	var live = l[:0]
+	for _, p := range l {
+		p.Update(elapsed, level)
+		if !p.Dead {
+			switch p.Owner {
+			case BossProjectile:
+				if !level.Player.Dead && p.Bounds().Overlaps(level.Player.Bounds()) {
+					p.Hit(level.Player)
+				}
+			case PlayerProjectile:
+				if level.Boss != nil && !level.Boss.Dead && p.Bounds().Overlaps(level.Boss.Bounds()) {
+					p.Hit(level.Boss)
+				}
+			}
+		}
+		if !p.Dead {
+			live = append(live, p)
+		}
+	}
+	for i := len(live); i < len(l); i++ {
+		l[i] = nil
+	}
+	return live
+}
+
+func (l ProjectileList) SpriteConfigs(sheet *twodee.Spritesheet) (out []twodee.SpriteConfig) {
+	out = make([]twodee.SpriteConfig, len(l))
+	for i, p := range l {
+		out[i] = p.SpriteConfig(sheet)
+	}
+	return
+}
+
+// ProjectileSnapshot is a projectile in flight. Who it was thrown by decides
+// what happens when it hits, so the handler isn't kept.
+type ProjectileSnapshot struct {
+	Pos      mgl32.Vec2      `json:"pos"`
+	Velocity mgl32.Vec2      `json:"velocity"`
+	Lifetime time.Duration   `json:"lifetime"`
+	Color    mgl32.Vec3      `json:"color"`
+	Owner    ProjectileOwner `json:"owner"`
+	Elapsed  time.Duration   `json:"elapsed"`
+}
+
+func (p *Projectile) Snapshot() ProjectileSnapshot {
+	return ProjectileSnapshot{
+		Pos:      p.Pos().Vec2,
+		Velocity: p.Velocity,
+		Lifetime: p.Lifetime,
+		Color:    p.Color,
+		Owner:    p.Owner,
+		Elapsed:  p.elapsed,
+	}
+}
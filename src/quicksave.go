@@ -0,0 +1,157 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// QuickSaveVersion is bumped whenever the quick save format changes.
+	// Quick saves are throwaway, so old ones are simply refused.
+	QuickSaveVersion = 1
+)
+
+// QuickSave is a level snapshot written to disk so that it can be picked up
+// again with a single key.
+type QuickSave struct {
+	Version  int            `json:"version"`
+	SavedAt  time.Time      `json:"saved_at"`
+	Snapshot *LevelSnapshot `json:"snapshot"`
+}
+
+func NewQuickSave(snapshot *LevelSnapshot) *QuickSave {
+	return &QuickSave{
+		Version:  QuickSaveVersion,
+		SavedAt:  time.Now(),
+		Snapshot: snapshot,
+	}
+}
+
+// QuickSavePath returns the path of the quick save for a save slot.
+func QuickSavePath(dir string, slot int) string {
+	return filepath.Join(dir, fmt.Sprintf("slot%v-quick.json", slot+1))
+}
+
+func LoadQuickSave(path string) (q *QuickSave, err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	q = &QuickSave{}
+	if err = json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("Quick save is corrupt: %v", err)
+	}
+	if q.Version != QuickSaveVersion {
+		return nil, fmt.Errorf("Quick save is version %v, need %v", q.Version, QuickSaveVersion)
+	}
+	if q.Snapshot == nil {
+		return nil, fmt.Errorf("Quick save is empty")
+	}
+	return
+}
+
+func (q *QuickSave) Write(path string) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = json.Marshal(q); err != nil {
+		return
+	}
+	return writeFileAtomic(path, data)
+}
+
+// QuickSave writes a snapshot of the level being played to the current
+// slot's quick save.
+func (l *GameLayer) QuickSave() (err error) {
+	var (
+		snapshot *LevelSnapshot
+		path     = QuickSavePath(l.app.saveDir, l.app.Slot)
+	)
+	if l.app.saveDir == "" {
+		return fmt.Errorf("Nowhere to save")
+	}
+	if snapshot, err = l.level.Snapshot(); err != nil {
+		return
+	}
+	if err = NewQuickSave(snapshot).Write(path); err != nil {
+		return
+	}
+	if l.app.State.Debug {
+		fmt.Printf("Quick saved to %v\n", path)
+	}
+	return
+}
+
+// QuickLoad reloads the level in the current slot's quick save and puts it
+// back exactly the way it was.
+func (l *GameLayer) QuickLoad() (err error) {
+	var (
+		q *QuickSave
+	)
+	if l.app.saveDir == "" {
+		return fmt.Errorf("Nowhere to load from")
+	}
+	if q, err = LoadQuickSave(QuickSavePath(l.app.saveDir, l.app.Slot)); err != nil {
+		return
+	}
+	// A recording has to start from the top of a level.
+	l.StopRecording()
+	return l.loadSnapshot(q.Snapshot)
+}
+
+// loadSnapshot loads the snapshot's level and puts everything in it back
+// where it was.
+func (l *GameLayer) loadSnapshot(s *LevelSnapshot) (err error) {
+	// Loading carries on the attempt rather than starting a new one, so
+	// that it can't be used to wipe out deaths.
+	deaths := l.app.State.AttemptDeaths
+	if err = l.loadLevel(s.Level); err != nil {
+		return
+	}
+	l.app.State.AttemptDeaths = deaths
+	if err = l.level.Restore(s); err != nil {
+		return
+	}
+	if l.level.Boss != nil {
+		l.app.GameEventHandler.Enqueue(NewBossColorEvent(l.level.Boss.Color))
+	}
+	l.updateCamera(1.0)
+	l.prevCamera = l.camera.WorldBounds
+	return
+}
+
+// updateQuickSave carries out a quick save or load asked for since the last
+// update. They wait for the start of an update so that no events from the
+// previous one are left undelivered.
+func (l *GameLayer) updateQuickSave() {
+	if l.quickLoad {
+		if err := l.QuickLoad(); err != nil {
+			fmt.Printf("Could not quick load: %v\n", err)
+		}
+	} else if l.quickSave {
+		if err := l.QuickSave(); err != nil {
+			fmt.Printf("Could not quick save: %v\n", err)
+		}
+	}
+	l.quickSave = false
+	l.quickLoad = false
+}
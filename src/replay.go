@@ -0,0 +1,135 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+const (
+	// ReplayVersion is bumped whenever the replay format or anything that
+	// changes how input plays out does.
+	ReplayVersion = 3
+)
+
+type InputButtons int32
+
+const (
+	_                      = iota
+	RunButton InputButtons = 1 << iota
+	AimButton
+	RollButton
+	ChargeButton
+	RewindButton
+)
+
+// InputFrame is everything the player did during a single update.
+type InputFrame struct {
+	X       float32      `json:"x"`
+	Y       float32      `json:"y"`
+	Buttons InputButtons `json:"b"`
+}
+
+func (f InputFrame) Pressed(b InputButtons) bool {
+	return f.Buttons&b == b
+}
+
+// Apply feeds the input to the player.
+func (f InputFrame) Apply(p *Player) {
+	p.MoveX(f.X)
+	p.MoveY(f.Y)
+	p.Run(f.Pressed(RunButton))
+	p.Aim(f.Pressed(AimButton))
+	if f.Pressed(RollButton) {
+		p.Roll()
+	}
+	if f.Pressed(ChargeButton) {
+		p.UseCharge()
+	}
+}
+
+// Replay is the input for every update from a known starting point. Played
+// back with the same step, it reproduces the run exactly.
+type Replay struct {
+	Version      int           `json:"version"`
+	Step         time.Duration `json:"step"`
+	Level        string        `json:"level"`
+	KilledBosses []string      `json:"killed_bosses"`
+	Frames       []InputFrame  `json:"frames"`
+}
+
+// NewReplay starts an empty replay from the given level and state.
+func NewReplay(step time.Duration, level string, state *State) *Replay {
+	r := &Replay{
+		Version:      ReplayVersion,
+		Step:         step,
+		Level:        level,
+		KilledBosses: []string{},
+		Frames:       []InputFrame{},
+	}
+	for name, killed := range state.KilledBosses {
+		if killed {
+			r.KilledBosses = append(r.KilledBosses, name)
+		}
+	}
+	sort.Strings(r.KilledBosses)
+	return r
+}
+
+// Restore sets up state the way it was when the replay started.
+func (r *Replay) Restore(state *State) {
+	state.KilledBosses = map[string]bool{}
+	for _, name := range r.KilledBosses {
+		state.KilledBosses[name] = true
+	}
+}
+
+func (r *Replay) Duration() time.Duration {
+	return time.Duration(len(r.Frames)) * r.Step
+}
+
+func LoadReplay(path string, step time.Duration) (r *Replay, err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	r = &Replay{}
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if r.Version != ReplayVersion {
+		return nil, fmt.Errorf("Replay %v is version %v, need %v", path, r.Version, ReplayVersion)
+	}
+	if r.Step != step {
+		return nil, fmt.Errorf("Replay %v was recorded with step %v, need %v", path, r.Step, step)
+	}
+	return
+}
+
+func (r *Replay) Save(path string) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = json.Marshal(r); err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
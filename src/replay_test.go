@@ -0,0 +1,185 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"github.com/go-gl/mathgl/mgl32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReplaySaveLoad(t *testing.T) {
+	var (
+		dir   = tempDir(t)
+		path  = filepath.Join(dir, "test.replay")
+		state = NewState()
+	)
+	defer os.RemoveAll(dir)
+	state.KilledBosses["boss2"] = true
+	state.KilledBosses["boss1"] = true
+	r := NewReplay(SimStep, "main", state)
+	r.Frames = append(r.Frames,
+		InputFrame{X: 1, Y: 0, Buttons: RunButton},
+		InputFrame{X: -0.5, Y: 0.25, Buttons: RollButton | AimButton},
+		InputFrame{},
+	)
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReplay(path, SimStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, r) {
+		t.Fatalf("Loaded %+v, saved %+v", loaded, r)
+	}
+	restored := NewState()
+	loaded.Restore(restored)
+	if !restored.KilledBosses["boss1"] || !restored.KilledBosses["boss2"] || len(restored.KilledBosses) != 2 {
+		t.Fatalf("Restored killed bosses %v", restored.KilledBosses)
+	}
+}
+
+func TestReplayRejectsMismatches(t *testing.T) {
+	var (
+		dir  = tempDir(t)
+		path = filepath.Join(dir, "test.replay")
+	)
+	defer os.RemoveAll(dir)
+	r := NewReplay(SimStep, "main", NewState())
+	r.Version = ReplayVersion - 1
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReplay(path, SimStep); err == nil {
+		t.Fatal("Loaded a replay from an old version")
+	}
+	r.Version = ReplayVersion
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReplay(path, SimStep*2); err == nil {
+		t.Fatal("Loaded a replay recorded with a different step")
+	}
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReplay(path, SimStep); err == nil {
+		t.Fatal("Loaded a corrupt replay")
+	}
+}
+
+// The attract mode demo has to be re-recorded whenever ReplayVersion is
+// bumped.
+func TestAttractReplayLoads(t *testing.T) {
+	r, err := LoadReplay(AttractReplay, SimStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Frames) == 0 {
+		t.Fatal("Demo has no input")
+	}
+}
+
+// replayEnd is where a replay leaves the simulation.
+type replayEnd struct {
+	Level     string
+	Player    mgl32.Vec2
+	Color     mgl32.Vec3
+	BossPhase int
+}
+
+// simulate plays r through the levels without drawing anything, the way
+// GameLayer.Update does.
+func simulate(t *testing.T, r *Replay) (start mgl32.Vec2, end replayEnd) {
+	var (
+		events = NewEventBus(NumGameEventTypes, IsRenderEvent)
+		sheet  *twodee.Spritesheet
+		level  *Level
+		subs   Subscriptions
+		data   []byte
+		err    error
+	)
+	if data, err = ioutil.ReadFile("resources/spritesheet.json"); err != nil {
+		t.Fatal(err)
+	}
+	if sheet, err = twodee.ParseTexturePackerJSONArrayString(string(data), PxPerUnit); err != nil {
+		t.Fatal(err)
+	}
+	load := func(name string) {
+		if level != nil {
+			level.Delete()
+		}
+		if level, err = newLevel(name, "resources/"+name+".tmx", sheet, events, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load(r.Level)
+	defer func() { level.Delete() }()
+	subs.Add(
+		Subscribe(events, PlayerDied, func(e twodee.GETyper) { level.Player.Die() }),
+		Subscribe(events, BossDied, func(e *BossDiedEvent) { level.Boss.Die() }),
+	)
+	defer subs.Release()
+	start = level.Player.Pos().Vec2
+	for _, input := range r.Frames {
+		events.PollSim()
+		input.Apply(level.Player)
+		level.Update(r.Step)
+		if collides, name := level.PortalCollides(); collides {
+			load(name)
+		}
+		events.PollRender()
+	}
+	events.PollSim()
+	end = replayEnd{
+		Level:     level.Name,
+		Player:    level.Player.Pos().Vec2,
+		Color:     level.Color,
+		BossPhase: -1,
+	}
+	if level.Boss != nil {
+		end.BossPhase = level.Boss.Phase
+	}
+	return
+}
+
+// Playing the demo twice has to end up in exactly the same place, or
+// replays drift out of sync with what was recorded.
+func TestAttractReplayIsDeterministic(t *testing.T) {
+	r, err := LoadReplay(AttractReplay, SimStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, first := simulate(t, r)
+	if first.Level == r.Level && first.Player.ApproxEqual(start) {
+		t.Fatalf("Demo never moves the player from %v", start)
+	}
+	if _, second := simulate(t, r); second != first {
+		t.Fatalf("Replayed demo ended at %+v, then at %+v", first, second)
+	}
+}
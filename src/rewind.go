@@ -0,0 +1,287 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"fmt"
+	"image/color"
+	"time"
+	"unsafe"
+)
+
+const (
+	// RewindLength is how far back the player can rewind.
+	RewindLength = 3 * time.Second
+	// RewindSteps is how many updates of history are kept for rewinding.
+	RewindSteps = int(RewindLength / SimStep)
+	// RewindUses is how many times the player may rewind in each boss fight.
+	RewindUses = 3
+	// RewindSpeed is how many updates are undone for each update the rewind
+	// button is held.
+	RewindSpeed = 2
+	// RewindOfferTime is how long the player has to rewind once their death
+	// has played out, before being sent back to the hub.
+	RewindOfferTime = 3 * time.Second
+)
+
+// Rewind is a ring buffer of level snapshots, one per update, which the player
+// can scrub back through. Once full, the oldest snapshot is dropped for each
+// one added, so memory use is capped at RewindSteps snapshots.
+type Rewind struct {
+	// Uses is how many more times the player may start rewinding.
+	Uses      int
+	snapshots []*LevelSnapshot
+	sizes     []int
+	next      int
+	count     int
+	bytes     int
+}
+
+func NewRewind(steps int) *Rewind {
+	return &Rewind{
+		snapshots: make([]*LevelSnapshot, steps),
+		sizes:     make([]int, steps),
+	}
+}
+
+// Reset forgets all history and allows uses more rewinds.
+func (r *Rewind) Reset(uses int) {
+	for i := range r.snapshots {
+		r.snapshots[i] = nil
+		r.sizes[i] = 0
+	}
+	r.next = 0
+	r.count = 0
+	r.bytes = 0
+	r.Uses = uses
+}
+
+// Push adds a snapshot as the newest point in history.
+func (r *Rewind) Push(s *LevelSnapshot) {
+	if len(r.snapshots) == 0 {
+		return
+	}
+	r.bytes -= r.sizes[r.next]
+	r.snapshots[r.next] = s
+	r.sizes[r.next] = snapshotSize(s)
+	r.bytes += r.sizes[r.next]
+	r.next = (r.next + 1) % len(r.snapshots)
+	if r.count < len(r.snapshots) {
+		r.count++
+	}
+}
+
+// Back drops the newest n snapshots and returns the oldest of those, or nil
+// if there is no history left.
+func (r *Rewind) Back(n int) (s *LevelSnapshot) {
+	for ; n > 0 && r.count > 0; n-- {
+		r.next = (r.next - 1 + len(r.snapshots)) % len(r.snapshots)
+		s = r.snapshots[r.next]
+		r.bytes -= r.sizes[r.next]
+		r.snapshots[r.next] = nil
+		r.sizes[r.next] = 0
+		r.count--
+	}
+	return
+}
+
+// Start uses up one rewind. Returns false if there are none left or nothing
+// to rewind to.
+func (r *Rewind) Start() bool {
+	if !r.Available() {
+		return false
+	}
+	r.Uses--
+	return true
+}
+
+// Available returns true if the player could start rewinding now.
+func (r *Rewind) Available() bool {
+	return r.Uses > 0 && r.count > 0
+}
+
+// Len returns how many updates of history are kept.
+func (r *Rewind) Len() int {
+	return r.count
+}
+
+// Bytes estimates how much memory the history holds on to.
+func (r *Rewind) Bytes() int {
+	return r.bytes
+}
+
+// mobStateSize estimates the memory held by a copied state, not counting the
+// paths it shares with the live one.
+func mobStateSize(state MobState) int {
+	switch state.(type) {
+	case *SearchState:
+		return int(unsafe.Sizeof(SearchState{}))
+	case *HuntState:
+		return int(unsafe.Sizeof(HuntState{}))
+	case *InvestigateState:
+		return int(unsafe.Sizeof(InvestigateState{}))
+	case *StaggerState:
+		return int(unsafe.Sizeof(StaggerState{}))
+	}
+	return int(unsafe.Sizeof(VegState{}))
+}
+
+// snapshotSize estimates the memory held by a snapshot. Boss phases are
+// shared with the boss, so they aren't counted.
+func snapshotSize(s *LevelSnapshot) (n int) {
+	n = int(unsafe.Sizeof(*s))
+	n += cap(s.Plates) * int(unsafe.Sizeof(PlateSnapshot{}))
+	n += cap(s.Projectiles) * int(unsafe.Sizeof(ProjectileSnapshot{}))
+	if s.Boss != nil {
+		n += int(unsafe.Sizeof(*s.Boss))
+		for _, state := range s.Boss.States {
+			n += int(unsafe.Sizeof(state)) + len(state.State)
+		}
+		for _, state := range s.Boss.stack {
+			n += int(unsafe.Sizeof(state)) + mobStateSize(state)
+		}
+	}
+	return
+}
+
+// RewindHud tells the player when they can rewind and shows that they are.
+type RewindHud struct {
+	text   *twodee.TextRenderer
+	font   *twodee.FontFace
+	camera *twodee.Camera
+	cache  *twodee.TextCache
+}
+
+func NewRewindHud(winb twodee.Rectangle) (h *RewindHud, err error) {
+	var (
+		camera *twodee.Camera
+		font   *twodee.FontFace
+	)
+	if font, err = twodee.NewFontFace("resources/fonts/slkscr.ttf", 24, color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, 160}); err != nil {
+		return
+	}
+	if camera, err = twodee.NewCamera(winb, winb); err != nil {
+		return
+	}
+	h = &RewindHud{
+		font:   font,
+		camera: camera,
+	}
+	return
+}
+
+func (h *RewindHud) Reset() (err error) {
+	if h.text != nil {
+		h.text.Delete()
+	}
+	if h.text, err = twodee.NewTextRenderer(h.camera); err != nil {
+		return
+	}
+	if h.cache != nil {
+		h.cache.Clear()
+	}
+	return
+}
+
+func (h *RewindHud) Delete() {
+	if h.text != nil {
+		h.text.Delete()
+		h.text = nil
+	}
+	if h.cache != nil {
+		h.cache.Delete()
+		h.cache = nil
+	}
+}
+
+// Draw shows label centered near the bottom of the screen.
+func (h *RewindHud) Draw(label string) {
+	if h.cache == nil {
+		h.cache = twodee.NewTextCache(h.font)
+	}
+	h.cache.SetText(label)
+	if h.cache.Texture == nil {
+		return
+	}
+	var (
+		bounds = h.camera.WorldBounds
+		x      = bounds.Midpoint().X() - float32(h.cache.Texture.Width)/2
+		y      = bounds.Min.Y() + 40
+	)
+	h.text.Bind()
+	h.text.Draw(h.cache.Texture, x, y)
+	h.text.Unbind()
+}
+
+// rewindLabel describes what the player can do about rewinding right now,
+// or returns an empty string if there's nothing to show.
+func (l *GameLayer) rewindLabel() string {
+	switch {
+	case l.rewinding:
+		return "<< Rewinding"
+	case l.level.Player.Dead && l.canRewind():
+		return fmt.Sprintf("Hold R to rewind (%v left)", l.rewind.Uses)
+	}
+	return ""
+}
+
+// canRewind returns true if the player could start rewinding now. Once the
+// boss is beaten there is nothing to go back for.
+func (l *GameLayer) canRewind() bool {
+	if l.level.Boss != nil && l.level.Boss.Dead {
+		return false
+	}
+	return l.rewind.Available()
+}
+
+// updateRewind scrubs back through history while the rewind button is held,
+// and otherwise records where this update starts from. Returns true if the
+// update was used up, either rewinding or giving up on a rewind after death.
+func (l *GameLayer) updateRewind(input InputFrame, elapsed time.Duration) bool {
+	if input.Pressed(RewindButton) && (l.rewinding || l.canRewind()) {
+		if !l.rewinding {
+			if l.level.Player.Dead {
+				l.app.Tracker.Undie()
+			}
+			l.rewind.Start()
+			l.rewinding = true
+			l.deathOffer = 0
+			if l.app.State.Debug {
+				fmt.Printf("Rewinding through %v updates (%v KB)\n", l.rewind.Len(), l.rewind.Bytes()/1024)
+			}
+		}
+		if s := l.rewind.Back(RewindSpeed); s != nil {
+			if err := l.level.Restore(s); err != nil {
+				fmt.Printf("Could not rewind: %v\n", err)
+			}
+		}
+		return true
+	}
+	l.rewinding = false
+	if l.deathOffer > 0 {
+		if l.deathOffer -= elapsed; l.deathOffer <= 0 {
+			l.deathOffer = 0
+			l.loadLevel("main")
+			return true
+		}
+	}
+	if l.rewind.Uses > 0 {
+		if s, err := l.level.MemorySnapshot(); err == nil {
+			l.rewind.Push(s)
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// SaveVersion is bumped whenever the save format changes.
+	SaveVersion = 2
+	// MinSaveVersion is the oldest save format which can still be read.
+	MinSaveVersion = 1
+	// SaveSlots is how many separate games can be saved.
+	SaveSlots = 3
+	// legacySaveName is where progress was kept before there were slots.
+	legacySaveName = "save.json"
+)
+
+// SaveGame is the player's progress between runs of the game.
+type SaveGame struct {
+	Version      int           `json:"version"`
+	SavedAt      time.Time     `json:"saved_at"`
+	KilledBosses []string      `json:"killed_bosses"`
+	HubPosition  *[2]float32   `json:"hub_position,omitempty"`
+	Playtime     time.Duration `json:"playtime"`
+	Stats        Stats         `json:"stats"`
+}
+
+// NewSaveGame captures the progress in state.
+func NewSaveGame(state *State) *SaveGame {
+	s := &SaveGame{
+		Version:      SaveVersion,
+		SavedAt:      time.Now(),
+		KilledBosses: []string{},
+		Playtime:     state.Playtime,
+		Stats:        state.Stats.Copy(),
+	}
+	for name, killed := range state.KilledBosses {
+		if killed {
+			s.KilledBosses = append(s.KilledBosses, name)
+		}
+	}
+	sort.Strings(s.KilledBosses)
+	if state.HubPosition != nil {
+		s.HubPosition = &[2]float32{state.HubPosition[0], state.HubPosition[1]}
+	}
+	return s
+}
+
+// Apply puts the saved progress into state.
+func (s *SaveGame) Apply(state *State) {
+	state.Reset()
+	for _, name := range s.KilledBosses {
+		state.KilledBosses[name] = true
+	}
+	state.Playtime = s.Playtime
+	state.Stats = s.Stats.Copy()
+	if s.HubPosition != nil {
+		state.HubPosition = &mgl32.Vec2{s.HubPosition[0], s.HubPosition[1]}
+	}
+}
+
+// SaveDir returns the directory progress and settings are kept in.
+func SaveDir() (dir string, err error) {
+	if dir, err = os.UserConfigDir(); err != nil {
+		return
+	}
+	return filepath.Join(dir, "chromos"), nil
+}
+
+// SlotPath returns the path of the progress file for a save slot.
+func SlotPath(dir string, slot int) string {
+	return filepath.Join(dir, fmt.Sprintf("slot%v.json", slot+1))
+}
+
+// ThumbnailPath returns the path of the screenshot for a save slot.
+func ThumbnailPath(dir string, slot int) string {
+	return filepath.Join(dir, fmt.Sprintf("slot%v.png", slot+1))
+}
+
+// LoadSlots reads every save slot in dir. Empty slots are nil, as are slots
+// which couldn't be read, in which case the error says why.
+func LoadSlots(dir string) (saves []*SaveGame, errs []error) {
+	saves = make([]*SaveGame, SaveSlots)
+	for i := range saves {
+		var err error
+		if saves[i], err = LoadSaveGame(SlotPath(dir, i)); err != nil {
+			errs = append(errs, fmt.Errorf("Slot %v: %v", i+1, err))
+		}
+	}
+	if saves[0] == nil && len(errs) == 0 {
+		// Progress from before there were slots goes in the first one.
+		if legacy, err := LoadSaveGame(filepath.Join(dir, legacySaveName)); err == nil {
+			saves[0] = legacy
+		}
+	}
+	return
+}
+
+// CopySlot copies the save and screenshot in one slot over another.
+func CopySlot(dir string, from, to int) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(SlotPath(dir, from)); err != nil {
+		return
+	}
+	if err = writeFileAtomic(SlotPath(dir, to), data); err != nil {
+		return
+	}
+	if data, err = ioutil.ReadFile(ThumbnailPath(dir, from)); err != nil {
+		// A save without a screenshot is still a save.
+		os.Remove(ThumbnailPath(dir, to))
+		return nil
+	}
+	return writeFileAtomic(ThumbnailPath(dir, to), data)
+}
+
+// DeleteSlot removes the save, screenshot and quick save in a slot.
+func DeleteSlot(dir string, slot int) (err error) {
+	if err = os.Remove(SlotPath(dir, slot)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Remove(ThumbnailPath(dir, slot)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Remove(QuickSavePath(dir, slot)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	return nil
+}
+
+// LoadSaveGame reads the progress file at path. Returns nil and no error if
+// there is no save yet.
+func LoadSaveGame(path string) (s *SaveGame, err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	s = &SaveGame{}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("Save file is corrupt: %v", err)
+	}
+	if s.Version < MinSaveVersion || s.Version > SaveVersion {
+		return nil, fmt.Errorf("Save file is version %v, need %v to %v", s.Version, MinSaveVersion, SaveVersion)
+	}
+	return
+}
+
+// Write saves to path. The file is replaced in one go, so a crash partway
+// through leaves the previous save intact.
+func (s *SaveGame) Write(path string) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = json.MarshalIndent(s, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place once it's safely on disk.
+func writeFileAtomic(path string, data []byte) (err error) {
+	var (
+		tmp *os.File
+	)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	if tmp, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadProgress reads every save slot and picks the most recently saved one
+// to continue. Failing to read a slot is not fatal; the player is told why.
+func (a *Application) loadProgress() {
+	var (
+		err  error
+		errs []error
+	)
+	if a.saveDir, err = SaveDir(); err != nil {
+		a.Saves = make([]*SaveGame, SaveSlots)
+		a.SaveMessage = fmt.Sprintf("Progress can't be saved: %v", err)
+	} else if a.Saves, errs = LoadSlots(a.saveDir); len(errs) > 0 {
+		a.SaveMessage = fmt.Sprintf("Could not load progress: %v", errs[0])
+		for _, err = range errs {
+			fmt.Printf("Could not load progress: %v\n", err)
+		}
+	}
+	a.unreadable = make([]bool, SaveSlots)
+	for i, save := range a.Saves {
+		if save != nil || a.saveDir == "" {
+			continue
+		}
+		if _, err = os.Stat(SlotPath(a.saveDir, i)); err == nil {
+			// Corrupt, or from a newer version. Leave it be until the
+			// player chooses to start over in it.
+			a.unreadable[i] = true
+		}
+	}
+	for i, save := range a.Saves {
+		if save != nil && (a.CurrentSave() == nil || save.SavedAt.After(a.CurrentSave().SavedAt)) {
+			a.Slot = i
+		}
+	}
+}
+
+// CurrentSave returns the progress saved in the slot being played, if any.
+func (a *Application) CurrentSave() *SaveGame {
+	return a.Saves[a.Slot]
+}
+
+// SaveProgress writes the player's progress and a screenshot to the slot
+// being played, unless that slot couldn't be read.
+func (a *Application) SaveProgress() {
+	if a.saveDir == "" || a.unreadable[a.Slot] {
+		return
+	}
+	save := NewSaveGame(a.State)
+	if err := save.Write(SlotPath(a.saveDir, a.Slot)); err != nil {
+		fmt.Printf("Could not save progress: %v\n", err)
+		return
+	}
+	a.Saves[a.Slot] = save
+	// Saves happen mid update, when the frame isn't ready to be read, so
+	// the screenshot waits for the next draw.
+	a.thumbnailPending = true
+	a.thumbnailSlot = a.Slot
+}
+
+// captureThumbnail saves a screenshot for the last save, if it is waiting
+// for one. Only the game is drawn into it, without menus or overlays.
+func (a *Application) captureThumbnail() {
+	if !a.thumbnailPending {
+		return
+	}
+	a.thumbnailPending = false
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	a.game.Render()
+	thumb := CaptureThumbnail()
+	if err := WriteThumbnail(ThumbnailPath(a.saveDir, a.thumbnailSlot), thumb); err != nil {
+		fmt.Printf("Could not save screenshot: %v\n", err)
+	}
+}
+
+// CopySave copies the progress in one slot over another.
+func (a *Application) CopySave(from, to int) (err error) {
+	if a.saveDir == "" || a.Saves[from] == nil {
+		return fmt.Errorf("Nothing to copy in slot %v", from+1)
+	}
+	if err = CopySlot(a.saveDir, from, to); err != nil {
+		return
+	}
+	copied := *a.Saves[from]
+	a.Saves[to] = &copied
+	a.unreadable[to] = false
+	return
+}
+
+// DeleteSave empties a slot.
+func (a *Application) DeleteSave(slot int) (err error) {
+	if a.saveDir == "" {
+		return
+	}
+	if err = DeleteSlot(a.saveDir, slot); err != nil {
+		return
+	}
+	a.Saves[slot] = nil
+	a.unreadable[slot] = false
+	return
+}
+
+// StartSlot plays a new game in slot, which is saved over even if it
+// couldn't be read.
+func (a *Application) StartSlot(slot int) {
+	a.Slot = slot
+	a.unreadable[slot] = false
+}
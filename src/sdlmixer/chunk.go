@@ -0,0 +1,227 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdlmixer
+
+// #include <stdlib.h>
+// #include <SDL_mixer.h>
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Chunk is a sound decoded into memory. Unlike a twodee SoundEffect, its
+// samples can be read, so it can be resampled.
+type Chunk struct {
+	chunk *C.Mix_Chunk
+	// data holds the samples of a chunk made by resampling, which
+	// SDL_mixer leaves for us to free.
+	data unsafe.Pointer
+}
+
+// LoadChunk decodes the sound file at path.
+func LoadChunk(path string) (c *Chunk, err error) {
+	var (
+		cpath = C.CString(path)
+		mode  = C.CString("rb")
+		chunk *C.Mix_Chunk
+	)
+	defer C.free(unsafe.Pointer(cpath))
+	defer C.free(unsafe.Pointer(mode))
+	if chunk = C.Mix_LoadWAV_RW(C.SDL_RWFromFile(cpath, mode), 1); chunk == nil {
+		return nil, fmt.Errorf("Could not load %v: %v", path, lastError())
+	}
+	return &Chunk{chunk: chunk}, nil
+}
+
+// Pitched returns a copy of the chunk resampled to play ratio times as
+// fast, which raises its pitch by ratio and shortens it to match. Only the
+// 16 bit formats SDL_mixer opens by default can be resampled.
+func (c *Chunk) Pitched(ratio float64) (p *Chunk, err error) {
+	var (
+		freq     C.int
+		format   C.Uint16
+		channels C.int
+	)
+	if C.Mix_QuerySpec(&freq, &format, &channels) == 0 {
+		return nil, fmt.Errorf("Mixer isn't open: %v", lastError())
+	}
+	if format != C.AUDIO_S16SYS {
+		return nil, fmt.Errorf("Can't resample audio format %#x", format)
+	}
+	if ratio <= 0 {
+		return nil, fmt.Errorf("Can't resample by %v", ratio)
+	}
+	var (
+		n      = int(channels)
+		src    = samples(unsafe.Pointer(c.chunk.abuf), int(c.chunk.alen)/2)
+		frames = len(src) / n
+		out    = int(float64(frames) / ratio)
+	)
+	if out == 0 {
+		return nil, fmt.Errorf("Chunk is too short to resample")
+	}
+	p = &Chunk{data: C.malloc(C.size_t(out * n * 2))}
+	dst := samples(p.data, out*n)
+	for i := 0; i < out; i++ {
+		// Linear interpolation between the two nearest source frames.
+		var (
+			pos  = float64(i) * ratio
+			j    = int(pos)
+			k    = j + 1
+			frac = pos - float64(j)
+		)
+		if k >= frames {
+			k = frames - 1
+		}
+		for ch := 0; ch < n; ch++ {
+			a, b := float64(src[j*n+ch]), float64(src[k*n+ch])
+			dst[i*n+ch] = int16(a + (b-a)*frac)
+		}
+	}
+	if p.chunk = C.Mix_QuickLoad_RAW((*C.Uint8)(p.data), C.Uint32(out*n*2)); p.chunk == nil {
+		p.Delete()
+		return nil, fmt.Errorf("Could not make resampled chunk: %v", lastError())
+	}
+	return
+}
+
+// Length returns how many seconds the chunk plays for.
+func (c *Chunk) Length() (seconds float64, err error) {
+	var (
+		freq  int
+		frame int
+	)
+	if freq, frame, err = spec(); err != nil {
+		return
+	}
+	return float64(int(c.chunk.alen)/frame) / float64(freq), nil
+}
+
+// Loop returns a copy of the part of the chunk from start to end seconds,
+// rotated to begin at seconds in. Played looping, it carries on from at to
+// end, then goes round from start without a gap. Times past the end of the
+// chunk are taken as its end.
+func (c *Chunk) Loop(start, end, at float64) (l *Chunk, err error) {
+	var (
+		freq  int
+		frame int
+	)
+	if freq, frame, err = spec(); err != nil {
+		return
+	}
+	var (
+		length = int(c.chunk.alen) / frame
+		offset = func(seconds float64) int {
+			i := int(seconds * float64(freq))
+			if i < 0 {
+				i = 0
+			}
+			if i > length {
+				i = length
+			}
+			return i * frame
+		}
+		from = offset(start)
+		to   = offset(end)
+		mid  = offset(at)
+	)
+	if to <= from {
+		return nil, fmt.Errorf("Can't loop from %v to %v seconds", start, end)
+	}
+	if mid < from || mid >= to {
+		mid = from
+	}
+	l = &Chunk{data: C.malloc(C.size_t(to - from))}
+	var (
+		src = bytes(unsafe.Pointer(c.chunk.abuf), int(c.chunk.alen))
+		dst = bytes(l.data, to-from)
+	)
+	copy(dst[copy(dst, src[mid:to]):], src[from:mid])
+	if l.chunk = C.Mix_QuickLoad_RAW((*C.Uint8)(l.data), C.Uint32(to-from)); l.chunk == nil {
+		l.Delete()
+		return nil, fmt.Errorf("Could not make looping chunk: %v", lastError())
+	}
+	return
+}
+
+// SetVolume sets how loud the chunk plays, from 0 to 128.
+func (c *Chunk) SetVolume(volume int) {
+	C.Mix_VolumeChunk(c.chunk, C.int(volume))
+}
+
+// Play plays the chunk once on channel, cutting off whatever was playing
+// there.
+func (c *Chunk) Play(channel int) error {
+	return c.play(channel, 0)
+}
+
+// PlayLooping plays the chunk on channel over and over until it's halted.
+func (c *Chunk) PlayLooping(channel int) error {
+	return c.play(channel, -1)
+}
+
+func (c *Chunk) play(channel, loops int) error {
+	if C.Mix_PlayChannelTimed(C.int(channel), c.chunk, C.int(loops), -1) < 0 {
+		return fmt.Errorf("Could not play on channel %v: %v", channel, lastError())
+	}
+	return nil
+}
+
+func (c *Chunk) Delete() {
+	if c.chunk != nil {
+		C.Mix_FreeChunk(c.chunk)
+		c.chunk = nil
+	}
+	if c.data != nil {
+		C.free(c.data)
+		c.data = nil
+	}
+}
+
+// Playing returns true if anything is playing on channel.
+func Playing(channel int) bool {
+	return C.Mix_Playing(C.int(channel)) != 0
+}
+
+// spec returns the mixer's sample rate and how many bytes make up one
+// sample for every channel.
+func spec() (freq, frame int, err error) {
+	var (
+		f        C.int
+		format   C.Uint16
+		channels C.int
+	)
+	if C.Mix_QuerySpec(&f, &format, &channels) == 0 {
+		return 0, 0, fmt.Errorf("Mixer isn't open: %v", lastError())
+	}
+	// The low byte of the format is its bits per sample.
+	return int(f), int(channels) * int(format&0xff) / 8, nil
+}
+
+// bytes views the n bytes at p.
+func bytes(p unsafe.Pointer, n int) []byte {
+	return (*[1 << 30]byte)(p)[:n:n]
+}
+
+// samples views the n 16 bit samples at p.
+func samples(p unsafe.Pointer, n int) []int16 {
+	return (*[1 << 28]int16)(p)[:n:n]
+}
+
+func lastError() string {
+	return C.GoString(C.SDL_GetError())
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sdlmixer calls the parts of SDL_mixer which twodee doesn't wrap.
+// It links the same SDL_mixer 1.2 as twodee, so it works on the mixer which
+// twodee opens, and must only be used once twodee has opened it.
+package sdlmixer
+
+// #cgo pkg-config: SDL_mixer
+// #include <SDL_mixer.h>
+import "C"
+
+import (
+	"fmt"
+)
+
+// SetVolume sets how loud channel plays, from 0 to 128. It's applied on top
+// of the volume of the chunk playing there.
+func SetVolume(channel, volume int) {
+	C.Mix_Volume(C.int(channel), C.int(volume))
+}
+
+// Pause pauses whatever is playing on channel.
+func Pause(channel int) {
+	C.Mix_Pause(C.int(channel))
+}
+
+// Resume carries on playing whatever was paused on channel.
+func Resume(channel int) {
+	C.Mix_Resume(C.int(channel))
+}
+
+// Paused returns true if channel is paused.
+func Paused(channel int) bool {
+	return C.Mix_Paused(C.int(channel)) != 0
+}
+
+// Halt stops whatever is playing on channel.
+func Halt(channel int) {
+	C.Mix_HaltChannel(C.int(channel))
+}
+
+// SetPanning sets how loud channel plays in the left and right speakers,
+// from 0 to 255 each. 255 in both turns panning off.
+func SetPanning(channel int, left, right uint8) error {
+	if C.Mix_SetPanning(C.int(channel), C.Uint8(left), C.Uint8(right)) == 0 {
+		return fmt.Errorf("Could not pan channel %v: %v", channel, C.GoString(C.SDL_GetError()))
+	}
+	return nil
+}
+
+// SetDistance quietens channel as if it were distance away, from 0 (right
+// here, which turns the effect off) to 255 (as far as can be heard).
+func SetDistance(channel int, distance uint8) error {
+	if C.Mix_SetDistance(C.int(channel), C.Uint8(distance)) == 0 {
+		return fmt.Errorf("Could not set distance of channel %v: %v", channel, C.GoString(C.SDL_GetError()))
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// SettingsVersion is bumped whenever the settings format changes.
+	SettingsVersion = 1
+	// MaxVolume is the loudest a sound can be set to play.
+	MaxVolume = 128
+)
+
+// WindowSizes are the window sizes offered in the options menu.
+var WindowSizes = [][2]int{
+	{1024, 640},
+	{1280, 800},
+	{1536, 960},
+	{1920, 1200},
+}
+
+// Key is a keyboard key, saved by name.
+type Key twodee.KeyCode
+
+// keyNames are the keys which can be bound, by the name they're saved under.
+var keyNames = map[string]twodee.KeyCode{
+	"A":         twodee.KeyA,
+	"C":         twodee.KeyC,
+	"D":         twodee.KeyD,
+	"E":         twodee.KeyE,
+	"F":         twodee.KeyF,
+	"L":         twodee.KeyL,
+	"M":         twodee.KeyM,
+	"N":         twodee.KeyN,
+	"P":         twodee.KeyP,
+	"Q":         twodee.KeyQ,
+	"R":         twodee.KeyR,
+	"S":         twodee.KeyS,
+	"W":         twodee.KeyW,
+	"X":         twodee.KeyX,
+	"Z":         twodee.KeyZ,
+	"Space":     twodee.KeySpace,
+	"LeftShift": twodee.KeyLeftShift,
+	"Tab":       twodee.KeyTab,
+	"Enter":     twodee.KeyEnter,
+	"Up":        twodee.KeyUp,
+	"Down":      twodee.KeyDown,
+	"Left":      twodee.KeyLeft,
+	"Right":     twodee.KeyRight,
+}
+
+func (k Key) MarshalText() ([]byte, error) {
+	for name, code := range keyNames {
+		if code == twodee.KeyCode(k) {
+			return []byte(name), nil
+		}
+	}
+	return nil, fmt.Errorf("Key %v can't be bound", int(k))
+}
+
+func (k *Key) UnmarshalText(text []byte) error {
+	code, ok := keyNames[string(text)]
+	if !ok {
+		return fmt.Errorf("Unknown key %q", text)
+	}
+	*k = Key(code)
+	return nil
+}
+
+// Pressed returns true if the key is held down.
+func (k Key) Pressed(events *twodee.EventHandler) bool {
+	return events.GetKey(twodee.KeyCode(k)) == twodee.Press
+}
+
+// KeyBindings are the keys for each of the player's actions.
+type KeyBindings struct {
+	Up     Key `json:"up"`
+	Down   Key `json:"down"`
+	Left   Key `json:"left"`
+	Right  Key `json:"right"`
+	Run    Key `json:"run"`
+	Aim    Key `json:"aim"`
+	Roll   Key `json:"roll"`
+	Charge Key `json:"charge"`
+	Rewind Key `json:"rewind"`
+	Music  Key `json:"music"`
+}
+
+// Accessibility are options which make the game easier to play for some.
+type Accessibility struct {
+	// ScreenShake shakes the camera when things hit hard.
+	ScreenShake bool `json:"screen_shake"`
+	// ReduceFlashing stops bosses flashing while they're staggered.
+	ReduceFlashing bool `json:"reduce_flashing"`
+}
+
+// Settings are the player's choices, kept between runs of the game.
+type Settings struct {
+	Version int `json:"version"`
+	// Volumes go from 0 to 100. Music and effects are also turned down
+	// by the master volume.
+	MasterVolume  int           `json:"master_volume"`
+	MusicVolume   int           `json:"music_volume"`
+	EffectsVolume int           `json:"effects_volume"`
+	Music         bool          `json:"music"`
+	Fullscreen    bool          `json:"fullscreen"`
+	WindowWidth   int           `json:"window_width"`
+	WindowHeight  int           `json:"window_height"`
+	VSync         bool          `json:"vsync"`
+	Debug         bool          `json:"debug"`
+	Keys          KeyBindings   `json:"keys"`
+	Accessibility Accessibility `json:"accessibility"`
+	// SpeedrunTimer shows the speedrun timer, which only times runs
+	// started while it's on.
+	SpeedrunTimer bool `json:"speedrun_timer"`
+	// unreadable is set when there is a settings file which couldn't be
+	// used. It isn't saved over until the player says so.
+	unreadable bool
+}
+
+// DefaultSettings are used for anything the settings file doesn't say.
+func DefaultSettings() *Settings {
+	return &Settings{
+		Version:       SettingsVersion,
+		MasterVolume:  100,
+		MusicVolume:   100,
+		EffectsVolume: 100,
+		Music:         true,
+		Fullscreen:    false,
+		WindowWidth:   WindowSizes[0][0],
+		WindowHeight:  WindowSizes[0][1],
+		VSync:         true,
+		Debug:         false,
+		Keys: KeyBindings{
+			Up:     Key(twodee.KeyUp),
+			Down:   Key(twodee.KeyDown),
+			Left:   Key(twodee.KeyLeft),
+			Right:  Key(twodee.KeyRight),
+			Run:    Key(twodee.KeyX),
+			Aim:    Key(twodee.KeyA),
+			Roll:   Key(twodee.KeyZ),
+			Charge: Key(twodee.KeyC),
+			Rewind: Key(twodee.KeyR),
+			Music:  Key(twodee.KeyM),
+		},
+		Accessibility: Accessibility{
+			ScreenShake:    true,
+			ReduceFlashing: false,
+		},
+	}
+}
+
+// SettingsPath returns the path of the settings file in dir.
+func SettingsPath(dir string) string {
+	return filepath.Join(dir, "settings.json")
+}
+
+// LoadSettings reads the settings file at path. Returns the defaults if
+// there is no file yet, or along with an error if it can't be read. Defaults
+// returned in place of a file which couldn't be read are Unreadable.
+func LoadSettings(path string) (s *Settings, err error) {
+	var (
+		data []byte
+	)
+	s = DefaultSettings()
+	defer func() { s.unreadable = err != nil }()
+	if data, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	loaded := DefaultSettings()
+	if err = json.Unmarshal(data, loaded); err != nil {
+		return s, fmt.Errorf("Settings file is corrupt: %v", err)
+	}
+	if loaded.Version != SettingsVersion {
+		return s, fmt.Errorf("Settings file is version %v, need %v", loaded.Version, SettingsVersion)
+	}
+	if loaded.WindowWidth <= 0 || loaded.WindowHeight <= 0 {
+		loaded.WindowWidth, loaded.WindowHeight = s.WindowWidth, s.WindowHeight
+	}
+	loaded.MasterVolume = clampVolume(loaded.MasterVolume)
+	loaded.MusicVolume = clampVolume(loaded.MusicVolume)
+	loaded.EffectsVolume = clampVolume(loaded.EffectsVolume)
+	return loaded, nil
+}
+
+// Unreadable returns true if the settings file couldn't be read and so won't
+// be saved over.
+func (s *Settings) Unreadable() bool {
+	return s.unreadable
+}
+
+// Overwrite lets the settings be saved over a file which couldn't be read.
+func (s *Settings) Overwrite() {
+	s.unreadable = false
+}
+
+func clampVolume(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
+}
+
+func (s *Settings) Write(path string) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = json.MarshalIndent(s, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(path, data)
+}
+
+// ApplySettings puts any settings which can change while the game runs into
+// effect. Fullscreen and the window size wait for the next start.
+func (a *Application) ApplySettings() {
+	if a.Settings.VSync {
+		a.Context.SetSwapInterval(1)
+	} else {
+		a.Context.SetSwapInterval(0)
+	}
+	if a.AudioSystem != nil {
+		a.AudioSystem.SetVolumes(a.Settings.MasterVolume, a.Settings.MusicVolume, a.Settings.EffectsVolume)
+	}
+}
+
+// SaveSettings writes the settings file, picking up the debug flag from the
+// game state. A file which couldn't be read is left alone, the same way as
+// an unreadable save slot, until the player chooses to overwrite it.
+func (a *Application) SaveSettings() {
+	a.Settings.Debug = a.State.Debug
+	if a.settingsPath == "" || a.Settings.Unreadable() {
+		return
+	}
+	if err := a.Settings.Write(a.settingsPath); err != nil {
+		fmt.Printf("Could not save settings: %v\n", err)
+	}
+}
+
+// SetMusic turns the music on or off and remembers the choice.
+func (a *Application) SetMusic(on bool) {
+	a.Settings.Music = on
+	if on {
+		a.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(ResumeMusic))
+	} else {
+		a.GameEventHandler.Enqueue(twodee.NewBasicGameEvent(PauseMusic))
+	}
+	a.SaveSettings()
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUnreadableSettingsAreKept(t *testing.T) {
+	var (
+		dir  = tempDir(t)
+		path = SettingsPath(dir)
+	)
+	defer os.RemoveAll(dir)
+	s, err := LoadSettings(path)
+	if err != nil || s.Unreadable() {
+		t.Fatalf("Missing settings file gave %v, unreadable %v", err, s.Unreadable())
+	}
+	if err = ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = LoadSettings(path); err == nil || !s.Unreadable() {
+		t.Fatalf("Corrupt settings file gave %v, unreadable %v", err, s.Unreadable())
+	}
+	s.Overwrite()
+	if err = s.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = LoadSettings(path); err != nil || s.Unreadable() {
+		t.Fatalf("Overwritten settings file gave %v, unreadable %v", err, s.Unreadable())
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"./sdlmixer"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// SoundBankPath is the file which says what sound each event makes.
+	SoundBankPath = "resources/sounds.json"
+	// FirstEffectChannel is the first mixer channel sounds play on, after
+	// the music's.
+	FirstEffectChannel = MusicChannels
+	// PitchSteps is how many pitches either side of normal each file is
+	// resampled to when its sound varies in pitch.
+	PitchSteps = 2
+)
+
+// SoundEntry is the sound an event makes. One of Files is picked at random
+// each time, played at Volume, from 0 to 1, and at a pitch up to
+// PitchVariance above or below normal. It won't play again until Cooldown
+// seconds have passed, nor while Voices copies are already playing. Higher
+// Priority sounds take channels from lower ones when every channel is busy.
+// Sounds played from somewhere in the world fade out over Range.
+type SoundEntry struct {
+	Files         []string `json:"files"`
+	Volume        float32  `json:"volume"`
+	PitchVariance float32  `json:"pitch_variance,omitempty"`
+	Cooldown      float64  `json:"cooldown,omitempty"`
+	Voices        int      `json:"voices,omitempty"`
+	Priority      int      `json:"priority,omitempty"`
+	Range         float32  `json:"range,omitempty"`
+}
+
+// HearingRange returns how far away the sound can be heard from.
+func (e *SoundEntry) HearingRange() float32 {
+	if e.Range <= 0 {
+		return SoundRange
+	}
+	return e.Range
+}
+
+// MaxVoices returns how many copies of the sound can play at once, at
+// least one.
+func (e *SoundEntry) MaxVoices() int {
+	if e.Voices < 1 {
+		return 1
+	}
+	return e.Voices
+}
+
+// SoundBank maps event type names, as in eventTypeNames, to their sounds.
+type SoundBank map[string]*SoundEntry
+
+// LoadSoundBank reads the sound bank at path.
+func LoadSoundBank(path string) (bank SoundBank, err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &bank); err != nil {
+		return nil, fmt.Errorf("Sound bank is corrupt: %v", err)
+	}
+	for name, entry := range bank {
+		if _, ok := EventTypeByName(name); !ok {
+			return nil, fmt.Errorf("Sound bank has unknown event %v", name)
+		}
+		if len(entry.Files) == 0 {
+			return nil, fmt.Errorf("Sound bank has no files for %v", name)
+		}
+	}
+	return
+}
+
+// Events returns the names of the events in the bank, in order.
+func (b SoundBank) Events() []string {
+	names := make([]string, 0, len(b))
+	for name := range b {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sound is a loaded sound bank entry.
+type Sound struct {
+	Entry *SoundEntry
+	// chunks holds every file, at every pitch it plays at.
+	chunks []*sdlmixer.Chunk
+	ready  time.Duration
+}
+
+// NewSound loads every file for entry, mixing them into the effects bus.
+// SDL_mixer can't change the pitch of a sound as it plays, so a sound which
+// varies in pitch has each file resampled to a few pitches up front.
+func NewSound(entry *SoundEntry, mixer *Mixer) (s *Sound, err error) {
+	s = &Sound{
+		Entry: entry,
+	}
+	for _, path := range entry.Files {
+		var chunk *sdlmixer.Chunk
+		if chunk, err = sdlmixer.LoadChunk(path); err != nil {
+			s.Delete()
+			return nil, err
+		}
+		s.add(chunk, mixer)
+		for _, ratio := range pitches(entry.PitchVariance) {
+			var pitched *sdlmixer.Chunk
+			if pitched, err = chunk.Pitched(ratio); err != nil {
+				fmt.Printf("Could not vary the pitch of %v: %v\n", path, err)
+				err = nil
+				break
+			}
+			s.add(pitched, mixer)
+		}
+	}
+	return
+}
+
+func (s *Sound) add(chunk *sdlmixer.Chunk, mixer *Mixer) {
+	s.chunks = append(s.chunks, chunk)
+	mixer.AddEffect(chunk, s.Entry.Volume, EffectsBus)
+}
+
+// pitches returns the speeds, other than normal, which a sound with pitch
+// variance v is resampled to. They're spread evenly out to v either side.
+func pitches(v float32) (ratios []float64) {
+	if v <= 0 {
+		return
+	}
+	for i := 1; i <= PitchSteps; i++ {
+		d := float64(v) * float64(i) / PitchSteps
+		ratios = append(ratios, 1-d, 1+d)
+	}
+	return
+}
+
+// Play plays one of the sound's files through pool unless it's cooling
+// down or can't be heard. now is the audio system's clock. at places the
+// sound in the world; nil plays it as is.
+func (s *Sound) Play(pool *ChannelPool, now time.Duration, at *Placement) {
+	if now < s.ready || (at != nil && at.Gain <= 0) {
+		return
+	}
+	var (
+		chunk   = s.chunks[rand.Intn(len(s.chunks))]
+		channel = pool.Claim(s, now)
+	)
+	if channel < 0 {
+		return
+	}
+	at.apply(channel)
+	if err := chunk.Play(channel); err != nil {
+		fmt.Printf("Could not play sound: %v\n", err)
+		return
+	}
+	s.ready = now + seconds(s.Entry.Cooldown)
+}
+
+func (s *Sound) Delete() {
+	for _, chunk := range s.chunks {
+		chunk.Delete()
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SplitsVersion is bumped whenever the splits file changes format.
+	SplitsVersion = 1
+	// FinishSplit is the name of the last split, taken on the win splash.
+	FinishSplit = "finish"
+)
+
+// Split is the time into a run at which a boss died.
+type Split struct {
+	Name string        `json:"name"`
+	Time time.Duration `json:"time"`
+}
+
+// Run is a finished speedrun.
+type Run struct {
+	Date   time.Time `json:"date"`
+	Splits []Split   `json:"splits"`
+}
+
+// Total returns how long the run took.
+func (r *Run) Total() time.Duration {
+	if len(r.Splits) == 0 {
+		return 0
+	}
+	return r.Splits[len(r.Splits)-1].Time
+}
+
+// Splits are the personal bests and every finished run, as saved in the
+// splits file.
+type Splits struct {
+	Version int `json:"version"`
+	// Best is the fastest time each split has been reached in.
+	Best map[string]time.Duration `json:"best"`
+	// PersonalBest is the fastest finished run.
+	PersonalBest *Run  `json:"personal_best,omitempty"`
+	Runs         []Run `json:"runs"`
+}
+
+// SplitsPath returns the path of the splits file in dir.
+func SplitsPath(dir string) string {
+	return filepath.Join(dir, "splits.json")
+}
+
+// LoadSplits reads the splits file at path, returning empty splits if there
+// isn't one yet.
+func LoadSplits(path string) (s *Splits, err error) {
+	var (
+		data []byte
+	)
+	s = &Splits{
+		Version: SplitsVersion,
+		Best:    map[string]time.Duration{},
+		Runs:    []Run{},
+	}
+	if data, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	loaded := &Splits{}
+	if err = json.Unmarshal(data, loaded); err != nil {
+		return s, fmt.Errorf("Splits file is corrupt: %v", err)
+	}
+	if loaded.Version != SplitsVersion {
+		return s, fmt.Errorf("Splits file is version %v, need %v", loaded.Version, SplitsVersion)
+	}
+	if loaded.Best == nil {
+		loaded.Best = map[string]time.Duration{}
+	}
+	return loaded, nil
+}
+
+func (s *Splits) Write(path string) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = json.MarshalIndent(s, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(path, data)
+}
+
+// SpeedrunTimer times a run from New Game to the win splash in real time,
+// leaving out time spent loading levels.
+type SpeedrunTimer struct {
+	Running bool
+	// Current holds the splits taken so far this run.
+	Current  Run
+	Splits   *Splits
+	started  time.Time
+	loading  time.Duration
+	stopped  time.Duration
+	finished bool
+	path     string
+}
+
+// NewSpeedrunTimer loads personal bests from path, which is also where
+// results are written. No results are written if path is empty.
+func NewSpeedrunTimer(path string) (t *SpeedrunTimer, err error) {
+	t = &SpeedrunTimer{path: path}
+	t.Splits, err = LoadSplits(path)
+	return
+}
+
+// Start starts a new run.
+func (t *SpeedrunTimer) Start() {
+	t.Running = true
+	t.finished = false
+	t.started = time.Now()
+	t.loading = 0
+	t.Current = Run{Date: t.started, Splits: []Split{}}
+}
+
+// Elapsed returns the time into the current or last run.
+func (t *SpeedrunTimer) Elapsed() time.Duration {
+	if !t.Running {
+		return t.stopped
+	}
+	return time.Since(t.started) - t.loading
+}
+
+// Loaded leaves time spent loading out of the run.
+func (t *SpeedrunTimer) Loaded(d time.Duration) {
+	if t.Running {
+		t.loading += d
+	}
+}
+
+// Split records reaching name, once per run, and keeps it if it's the best
+// time to reach name yet.
+func (t *SpeedrunTimer) Split(name string) {
+	if !t.Running {
+		return
+	}
+	for _, s := range t.Current.Splits {
+		if s.Name == name {
+			return
+		}
+	}
+	split := Split{name, t.Elapsed()}
+	t.Current.Splits = append(t.Current.Splits, split)
+	if best, ok := t.Splits.Best[name]; !ok || split.Time < best {
+		t.Splits.Best[name] = split.Time
+	}
+	t.write()
+}
+
+// Finish takes the last split, stops the timer and saves the run.
+func (t *SpeedrunTimer) Finish() {
+	if !t.Running {
+		return
+	}
+	t.Split(FinishSplit)
+	t.stopped = t.Elapsed()
+	t.Running = false
+	t.finished = true
+	t.Splits.Runs = append(t.Splits.Runs, t.Current)
+	if pb := t.Splits.PersonalBest; pb == nil || t.Current.Total() < pb.Total() {
+		run := t.Current
+		t.Splits.PersonalBest = &run
+	}
+	t.write()
+}
+
+// Stop abandons the current run without saving it, and stops showing the
+// splits from the last one.
+func (t *SpeedrunTimer) Stop() {
+	t.stopped = t.Elapsed()
+	t.Running = false
+	t.finished = false
+	t.Current = Run{}
+}
+
+func (t *SpeedrunTimer) write() {
+	if t.path == "" {
+		return
+	}
+	if err := t.Splits.Write(t.path); err != nil {
+		fmt.Printf("Could not save splits: %v\n", err)
+	}
+}
+
+// loadSplits sets up the speedrun timer with the personal bests saved
+// alongside the save slots.
+func (a *Application) loadSplits() {
+	var (
+		path = ""
+		err  error
+	)
+	if a.saveDir != "" {
+		path = SplitsPath(a.saveDir)
+	}
+	if a.Speedrun, err = NewSpeedrunTimer(path); err != nil {
+		fmt.Printf("Could not load splits: %v\n", err)
+	}
+}
+
+// formatRunTime shows d as minutes, seconds and hundredths.
+func formatRunTime(d time.Duration) string {
+	var (
+		cs = d / (10 * time.Millisecond)
+	)
+	return fmt.Sprintf("%v:%02d.%02d", cs/6000, cs/100%60, cs%100)
+}
+
+// formatDelta shows how far ahead (-) or behind (+) d is.
+func formatDelta(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatRunTime(-d)
+	}
+	return "+" + formatRunTime(d)
+}
+
+// SpeedrunLayer runs the speedrun timer off game events and shows it in the
+// bottom right while the timer is turned on in the settings.
+type SpeedrunLayer struct {
+	text   *twodee.TextRenderer
+	font   *twodee.FontFace
+	cache  []*twodee.TextCache
+	camera *twodee.Camera
+	app    *Application
+	game   *GameLayer
+	subs   Subscriptions
+}
+
+func NewSpeedrunLayer(winb twodee.Rectangle, app *Application, game *GameLayer) (layer *SpeedrunLayer, err error) {
+	var (
+		camera *twodee.Camera
+		font   *twodee.FontFace
+	)
+	if font, err = twodee.NewFontFace("resources/fonts/slkscr.ttf", 16, color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, 160}); err != nil {
+		return
+	}
+	if camera, err = twodee.NewCamera(winb, winb); err != nil {
+		return
+	}
+	layer = &SpeedrunLayer{
+		font:   font,
+		camera: camera,
+		app:    app,
+		game:   game,
+	}
+	layer.subs.Add(
+		Subscribe(app.GameEventHandler, NewGame, layer.newGame),
+		Subscribe(app.GameEventHandler, ContinueGame, layer.continueGame),
+		Subscribe(app.GameEventHandler, BossDied, layer.bossDied),
+		Subscribe(app.GameEventHandler, GameWon, layer.gameWon),
+	)
+	err = layer.Reset()
+	return
+}
+
+func (sl *SpeedrunLayer) Reset() (err error) {
+	if sl.text != nil {
+		sl.text.Delete()
+	}
+	if sl.text, err = twodee.NewTextRenderer(sl.camera); err != nil {
+		return
+	}
+	for _, c := range sl.cache {
+		c.Clear()
+	}
+	return
+}
+
+func (sl *SpeedrunLayer) Delete() {
+	sl.subs.Release()
+	sl.text.Delete()
+	for _, c := range sl.cache {
+		c.Delete()
+	}
+}
+
+func (sl *SpeedrunLayer) Render() {
+	var (
+		timer = sl.app.Speedrun
+	)
+	if !sl.app.Settings.SpeedrunTimer || (!timer.Running && !timer.finished) {
+		return
+	}
+	var (
+		lines = []string{}
+		y     = sl.camera.WorldBounds.Min.Y() + 10
+	)
+	for _, s := range timer.Current.Splits {
+		line := fmt.Sprintf("%v %v", s.Name, formatRunTime(s.Time))
+		if pb := timer.Splits.PersonalBest; pb != nil {
+			for _, b := range pb.Splits {
+				if b.Name == s.Name {
+					line += " " + formatDelta(s.Time-b.Time)
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	if timer.Running {
+		lines = append(lines, formatRunTime(timer.Elapsed()))
+	}
+	for len(sl.cache) < len(lines) {
+		sl.cache = append(sl.cache, twodee.NewTextCache(sl.font))
+	}
+	sl.text.Bind()
+	// Latest at the bottom, drawn upward.
+	for i := len(lines) - 1; i >= 0; i-- {
+		c := sl.cache[i]
+		c.SetText(lines[i])
+		if c.Texture != nil {
+			x := sl.camera.WorldBounds.Max.X() - float32(c.Texture.Width) - 10
+			sl.text.Draw(c.Texture, x, y)
+			y = y + float32(c.Texture.Height)
+		}
+	}
+	sl.text.Unbind()
+}
+
+func (sl *SpeedrunLayer) Update(elapsed time.Duration) {
+}
+
+func (sl *SpeedrunLayer) HandleEvent(evt twodee.Event) bool {
+	return true
+}
+
+func (sl *SpeedrunLayer) newGame(e *SlotEvent) {
+	if sl.app.Settings.SpeedrunTimer {
+		sl.app.Speedrun.Start()
+	} else {
+		sl.app.Speedrun.Stop()
+	}
+}
+
+// continueGame abandons the run, since part of it wasn't timed.
+func (sl *SpeedrunLayer) continueGame(e *SlotEvent) {
+	sl.app.Speedrun.Stop()
+}
+
+// bossDied takes a split, unless the boss died in a replay.
+func (sl *SpeedrunLayer) bossDied(e *BossDiedEvent) {
+	if sl.game.playback == nil {
+		sl.app.Speedrun.Split(e.Name)
+	}
+}
+
+func (sl *SpeedrunLayer) gameWon(e twodee.GETyper) {
+	if sl.game.playback == nil {
+		sl.app.Speedrun.Finish()
+	}
+}
@@ -14,16 +14,68 @@
 
 package main
 
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"time"
+)
+
+// Stats are running totals kept over a whole game.
+type Stats struct {
+	Deaths        int `json:"deaths"`
+	Rolls         int `json:"rolls"`
+	PhasesCleared int `json:"phases_cleared"`
+	ColorChanges  int `json:"color_changes"`
+	BossesKilled  int `json:"bosses_killed"`
+	// LevelTime is the time spent in each level.
+	LevelTime map[string]time.Duration `json:"level_time,omitempty"`
+	// LevelDeaths is the number of deaths in each level.
+	LevelDeaths map[string]int `json:"level_deaths,omitempty"`
+}
+
+// Copy returns stats which don't share any maps with s.
+func (s Stats) Copy() Stats {
+	c := s
+	c.LevelTime = map[string]time.Duration{}
+	for k, v := range s.LevelTime {
+		c.LevelTime[k] = v
+	}
+	c.LevelDeaths = map[string]int{}
+	for k, v := range s.LevelDeaths {
+		c.LevelDeaths[k] = v
+	}
+	return c
+}
+
 type State struct {
 	Exit         bool
 	Debug        bool
 	KilledBosses map[string]bool
+	// Playing is set once a game has been started or continued, and
+	// means there's progress worth saving.
+	Playing bool
+	// HubPosition is where the player last stood in the hub, if anywhere.
+	HubPosition *mgl32.Vec2
+	Playtime    time.Duration
+	Stats       Stats
+	// AttemptDeaths is the number of deaths since the current level was
+	// last loaded, not counting any undone by rewinding.
+	AttemptDeaths int
 }
 
 func NewState() *State {
-	return &State{
-		Exit:         false,
-		Debug:        false,
-		KilledBosses: map[string]bool{},
+	s := &State{
+		Exit:  false,
+		Debug: false,
 	}
+	s.Reset()
+	return s
+}
+
+// Reset clears all progress, for starting a new game.
+func (s *State) Reset() {
+	s.KilledBosses = map[string]bool{}
+	s.HubPosition = nil
+	s.Playtime = 0
+	s.Stats = Stats{}.Copy()
+	s.AttemptDeaths = 0
 }
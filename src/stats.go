@@ -0,0 +1,147 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"fmt"
+	"time"
+)
+
+// StatsTracker counts up the game's stats from its events and unlocks
+// achievements as they're earned.
+type StatsTracker struct {
+	// Level is the level being played.
+	Level string
+	// Paused stops anything being counted, for example while a replay
+	// plays.
+	Paused       bool
+	Achievements *Achievements
+	state        *State
+	events       *EventBus
+	subs         Subscriptions
+}
+
+func NewStatsTracker(state *State, events *EventBus, achievements *Achievements) *StatsTracker {
+	t := &StatsTracker{
+		Achievements: achievements,
+		state:        state,
+		events:       events,
+	}
+	t.subs.Add(
+		Subscribe(events, BossDied, t.bossDied),
+		Subscribe(events, BossPhaseChange, t.bossPhaseChange),
+		Subscribe(events, PlayRollEffect, t.roll),
+		Subscribe(events, ChangeColor, t.changeColor),
+		Subscribe(events, GameWon, t.won),
+	)
+	return t
+}
+
+func (t *StatsTracker) Delete() {
+	t.subs.Release()
+}
+
+// StartAttempt starts counting stats for a fresh attempt at level. Levels
+// loaded while paused don't start one.
+func (t *StatsTracker) StartAttempt(level string) {
+	if t.Paused {
+		return
+	}
+	t.Level = level
+	t.state.AttemptDeaths = 0
+}
+
+// Undie takes back the latest death in this attempt, once it has been
+// rewound.
+func (t *StatsTracker) Undie() {
+	if t.Paused || t.state.AttemptDeaths == 0 {
+		return
+	}
+	t.state.AttemptDeaths--
+}
+
+// Update counts time spent in the current level.
+func (t *StatsTracker) Update(elapsed time.Duration) {
+	if t.Paused || t.Level == "" {
+		return
+	}
+	t.state.Stats.LevelTime[t.Level] += elapsed
+}
+
+// Died counts the player dying. Several hits in the same update each send a
+// PlayerDied event, so this is called when the player actually dies rather
+// than for every event.
+func (t *StatsTracker) Died() {
+	if t.Paused {
+		return
+	}
+	t.state.Stats.Deaths++
+	t.state.Stats.LevelDeaths[t.Level]++
+	t.state.AttemptDeaths++
+	t.check(OnPlayerDied, t.Level)
+}
+
+func (t *StatsTracker) bossDied(e *BossDiedEvent) {
+	if t.Paused {
+		return
+	}
+	t.state.Stats.BossesKilled++
+	t.check(OnBossDied, e.Name)
+}
+
+func (t *StatsTracker) bossPhaseChange(e *BossPhaseChangeEvent) {
+	if t.Paused {
+		return
+	}
+	t.state.Stats.PhasesCleared++
+}
+
+func (t *StatsTracker) roll(e twodee.GETyper) {
+	if t.Paused {
+		return
+	}
+	t.state.Stats.Rolls++
+	t.check(OnRoll, t.Level)
+}
+
+// changeColor counts plates lit, not the color fading again.
+func (t *StatsTracker) changeColor(e *ColorEvent) {
+	if t.Paused || !e.Add {
+		return
+	}
+	t.state.Stats.ColorChanges++
+	t.check(OnColorChange, t.Level)
+}
+
+func (t *StatsTracker) won(e twodee.GETyper) {
+	if t.Paused {
+		return
+	}
+	t.check(OnWon, t.Level)
+}
+
+// check unlocks any achievements earned and announces them.
+func (t *StatsTracker) check(on, level string) {
+	if t.Achievements == nil {
+		return
+	}
+	for _, a := range t.Achievements.Check(on, level, t.state) {
+		if t.state.Debug {
+			fmt.Printf("Achievement unlocked: %v\n", a.Name)
+		}
+		t.events.Enqueue(NewAchievementEvent(a.ID, a.Name))
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"bytes"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"image"
+	"image/png"
+)
+
+const (
+	ThumbnailWidth  = 160
+	ThumbnailHeight = 100
+)
+
+// CaptureThumbnail shrinks the frame just rendered to the back buffer down
+// to thumbnail size. The whole viewport is read, so on high DPI displays
+// this is the framebuffer rather than the window's logical size.
+func CaptureThumbnail() *image.RGBA {
+	var (
+		_, _, w, h = twodee.GetInteger4(gl.VIEWPORT)
+		pixels     = make([]byte, w*h*4)
+		thumb      = image.NewRGBA(image.Rect(0, 0, ThumbnailWidth, ThumbnailHeight))
+	)
+	gl.ReadBuffer(gl.BACK)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, int32(w), int32(h), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	for y := 0; y < ThumbnailHeight; y++ {
+		// GL rows start at the bottom.
+		sy := h - 1 - y*h/ThumbnailHeight
+		for x := 0; x < ThumbnailWidth; x++ {
+			var (
+				sx  = x * w / ThumbnailWidth
+				src = (sy*w + sx) * 4
+				dst = thumb.PixOffset(x, y)
+			)
+			copy(thumb.Pix[dst:dst+3], pixels[src:src+3])
+			thumb.Pix[dst+3] = 255
+		}
+	}
+	return thumb
+}
+
+// WriteThumbnail saves img as a PNG at path.
+func WriteThumbnail(path string, img image.Image) (err error) {
+	var (
+		buf bytes.Buffer
+	)
+	if err = png.Encode(&buf, img); err != nil {
+		return
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"fmt"
+	"image/color"
+	"time"
+)
+
+const (
+	// ToastTime is how long each toast stays on screen.
+	ToastTime = 4 * time.Second
+)
+
+// ToastLayer pops up a message at the top of the screen whenever an
+// achievement is unlocked, one at a time.
+type ToastLayer struct {
+	text    *twodee.TextRenderer
+	font    *twodee.FontFace
+	cache   *twodee.TextCache
+	camera  *twodee.Camera
+	queue   []string
+	showing time.Duration
+	subs    Subscriptions
+}
+
+func NewToastLayer(winb twodee.Rectangle, app *Application) (layer *ToastLayer, err error) {
+	var (
+		camera *twodee.Camera
+		font   *twodee.FontFace
+	)
+	if font, err = twodee.NewFontFace("resources/fonts/slkscr.ttf", 24, color.RGBA{255, 240, 120, 255}, color.RGBA{0, 0, 0, 192}); err != nil {
+		return
+	}
+	if camera, err = twodee.NewCamera(winb, winb); err != nil {
+		return
+	}
+	layer = &ToastLayer{
+		font:   font,
+		camera: camera,
+	}
+	layer.subs.Add(
+		Subscribe(app.GameEventHandler, AchievementUnlocked, layer.achievementUnlocked),
+	)
+	err = layer.Reset()
+	return
+}
+
+func (tl *ToastLayer) Reset() (err error) {
+	if tl.text != nil {
+		tl.text.Delete()
+	}
+	if tl.text, err = twodee.NewTextRenderer(tl.camera); err != nil {
+		return
+	}
+	if tl.cache != nil {
+		tl.cache.Clear()
+	}
+	return
+}
+
+func (tl *ToastLayer) Delete() {
+	tl.subs.Release()
+	tl.text.Delete()
+	if tl.cache != nil {
+		tl.cache.Delete()
+	}
+}
+
+func (tl *ToastLayer) Render() {
+	if len(tl.queue) == 0 {
+		return
+	}
+	if tl.cache == nil {
+		tl.cache = twodee.NewTextCache(tl.font)
+	}
+	tl.cache.SetText(tl.queue[0])
+	if tl.cache.Texture == nil {
+		return
+	}
+	var (
+		bounds = tl.camera.WorldBounds
+		x      = bounds.Midpoint().X() - float32(tl.cache.Texture.Width)/2
+		y      = bounds.Max.Y() - float32(tl.cache.Texture.Height) - 20
+	)
+	tl.text.Bind()
+	tl.text.Draw(tl.cache.Texture, x, y)
+	tl.text.Unbind()
+}
+
+func (tl *ToastLayer) Update(elapsed time.Duration) {
+	if len(tl.queue) == 0 {
+		return
+	}
+	if tl.showing += elapsed; tl.showing >= ToastTime {
+		tl.queue = tl.queue[1:]
+		tl.showing = 0
+	}
+}
+
+func (tl *ToastLayer) HandleEvent(evt twodee.Event) bool {
+	return true
+}
+
+func (tl *ToastLayer) achievementUnlocked(e *AchievementEvent) {
+	tl.queue = append(tl.queue, fmt.Sprintf("Achievement unlocked: %v", e.Name))
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TraceEnqueued   = "enqueue"
+	TraceDispatched = "dispatch"
+)
+
+// TraceRecord is a single line of an event trace.
+type TraceRecord struct {
+	Frame   int64                  `json:"frame"`
+	SimTime float64                `json:"sim_time"`
+	Action  string                 `json:"action"`
+	Type    string                 `json:"type"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// String formats the record for the event log overlay.
+func (r TraceRecord) String() string {
+	var (
+		keys   = make([]string, 0, len(r.Fields))
+		fields = make([]string, 0, len(r.Fields))
+	)
+	for k := range r.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%v=%v", k, r.Fields[k]))
+	}
+	return fmt.Sprintf("%6d %8.3f %-8v %v %v", r.Frame, r.SimTime, r.Action, r.Type, strings.Join(fields, " "))
+}
+
+// EventTrace writes game events as JSON lines and keeps the most recent
+// records around for the event log overlay.
+type EventTrace struct {
+	Frame   int64
+	SimTime time.Duration
+	file    *os.File
+	out     *bufio.Writer
+	enc     *json.Encoder
+	recent  []TraceRecord
+	next    int
+	full    bool
+}
+
+// NewEventTrace creates the trace file at path, keeping the last keep
+// records in memory.
+func NewEventTrace(path string, keep int) (t *EventTrace, err error) {
+	var (
+		file *os.File
+	)
+	if file, err = os.Create(path); err != nil {
+		return
+	}
+	t = &EventTrace{
+		file:   file,
+		out:    bufio.NewWriter(file),
+		recent: make([]TraceRecord, keep),
+	}
+	t.enc = json.NewEncoder(t.out)
+	return
+}
+
+// Step advances the trace's sim time. Call once per update.
+func (t *EventTrace) Step(elapsed time.Duration) {
+	t.SimTime += elapsed
+}
+
+// NextFrame advances the trace's frame number. Call once per rendered frame.
+func (t *EventTrace) NextFrame() {
+	t.Frame++
+}
+
+// Record adds an event to the trace.
+func (t *EventTrace) Record(action string, e twodee.GETyper) {
+	r := TraceRecord{
+		Frame:   t.Frame,
+		SimTime: t.SimTime.Seconds(),
+		Action:  action,
+		Type:    EventTypeName(e.GEType()),
+		Fields:  eventFields(e),
+	}
+	if err := t.enc.Encode(r); err != nil {
+		fmt.Printf("Could not write event trace: %v\n", err)
+	}
+	if len(t.recent) == 0 {
+		return
+	}
+	t.recent[t.next] = r
+	t.next = (t.next + 1) % len(t.recent)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Recent returns the records kept in memory, oldest first.
+func (t *EventTrace) Recent() []TraceRecord {
+	if !t.full {
+		return t.recent[:t.next]
+	}
+	return append(append([]TraceRecord{}, t.recent[t.next:]...), t.recent[:t.next]...)
+}
+
+// Close flushes and closes the trace file.
+func (t *EventTrace) Close() (err error) {
+	if err = t.out.Flush(); err != nil {
+		t.file.Close()
+		return
+	}
+	return t.file.Close()
+}
+
+// eventFields collects the exported payload fields of an event.
+func eventFields(e twodee.GETyper) (fields map[string]interface{}) {
+	v := reflect.ValueOf(e)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		var (
+			field = v.Type().Field(i)
+			value = v.Field(i)
+		)
+		if field.Anonymous || field.PkgPath != "" {
+			continue // Embedded BasicGameEvent or unexported.
+		}
+		if fields == nil {
+			fields = map[string]interface{}{}
+		}
+		if d, ok := value.Interface().(time.Duration); ok {
+			fields[field.Name] = d.String()
+		} else {
+			fields[field.Name] = value.Interface()
+		}
+	}
+	return
+}
@@ -0,0 +1,188 @@
+// Copyright 2015 Pikkpoiss
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"../lib/twodee"
+	"fmt"
+	"image/color"
+	"time"
+)
+
+const (
+	// TraceKeep is how many events the trace keeps for the event log.
+	TraceKeep = 500
+	// TraceLines is how many events the event log shows at once.
+	TraceLines = 24
+)
+
+// TraceLayer toggles event tracing and shows the most recent traced events
+// while in debug mode. F5 starts and stops a trace; page up and page down
+// scroll the log.
+type TraceLayer struct {
+	text   *twodee.TextRenderer
+	font   *twodee.FontFace
+	cache  []*twodee.TextCache
+	camera *twodee.Camera
+	app    *Application
+	scroll int
+}
+
+func NewTraceLayer(winb twodee.Rectangle, app *Application) (layer *TraceLayer, err error) {
+	var (
+		camera *twodee.Camera
+		font   *twodee.FontFace
+	)
+	if font, err = twodee.NewFontFace("resources/fonts/slkscr.ttf", 12, color.RGBA{220, 220, 220, 255}, color.RGBA{0, 0, 0, 160}); err != nil {
+		return
+	}
+	if camera, err = twodee.NewCamera(winb, winb); err != nil {
+		return
+	}
+	layer = &TraceLayer{
+		font:   font,
+		camera: camera,
+		app:    app,
+	}
+	err = layer.Reset()
+	return
+}
+
+func (tl *TraceLayer) Reset() (err error) {
+	if tl.text != nil {
+		tl.text.Delete()
+	}
+	if tl.text, err = twodee.NewTextRenderer(tl.camera); err != nil {
+		return
+	}
+	for _, c := range tl.cache {
+		c.Clear()
+	}
+	return
+}
+
+func (tl *TraceLayer) Delete() {
+	tl.text.Delete()
+	for _, c := range tl.cache {
+		c.Delete()
+	}
+	tl.app.GameEventHandler.StopTrace()
+}
+
+func (tl *TraceLayer) Render() {
+	var (
+		trace = tl.app.GameEventHandler.Trace
+	)
+	if trace == nil || !tl.app.State.Debug {
+		return
+	}
+	var (
+		recent = trace.Recent()
+		end    = len(recent) - tl.scroll
+		start  = end - TraceLines
+		y      = tl.camera.WorldBounds.Min.Y()
+	)
+	if start < 0 {
+		start = 0
+	}
+	for len(tl.cache) < TraceLines {
+		tl.cache = append(tl.cache, twodee.NewTextCache(tl.font))
+	}
+	tl.text.Bind()
+	// Newest at the bottom, drawn upward.
+	for i := end - 1; i >= start; i-- {
+		c := tl.cache[end-1-i]
+		c.SetText(recent[i].String())
+		if c.Texture != nil {
+			tl.text.Draw(c.Texture, 10, y)
+			y = y + float32(c.Texture.Height)
+		}
+	}
+	tl.text.Unbind()
+}
+
+func (tl *TraceLayer) Update(elapsed time.Duration) {
+}
+
+func (tl *TraceLayer) HandleEvent(evt twodee.Event) bool {
+	event, ok := evt.(*twodee.KeyEvent)
+	if !ok || event.Type == twodee.Release || !tl.app.State.Debug {
+		return true
+	}
+	switch event.Code {
+	case twodee.KeyF5:
+		tl.toggleTrace()
+		return false
+	case twodee.KeyPageUp:
+		tl.scrollBy(TraceLines / 2)
+		return false
+	case twodee.KeyPageDown:
+		tl.scrollBy(-TraceLines / 2)
+		return false
+	}
+	return true
+}
+
+func (tl *TraceLayer) scrollBy(n int) {
+	var (
+		trace = tl.app.GameEventHandler.Trace
+		max   = 0
+	)
+	if trace == nil {
+		return
+	}
+	if max = len(trace.Recent()) - TraceLines; max < 0 {
+		max = 0
+	}
+	tl.scroll += n
+	if tl.scroll > max {
+		tl.scroll = max
+	}
+	if tl.scroll < 0 {
+		tl.scroll = 0
+	}
+}
+
+func (tl *TraceLayer) toggleTrace() {
+	var (
+		events = tl.app.GameEventHandler
+		path   = fmt.Sprintf("trace-%v.jsonl", time.Now().Format("20060102-150405"))
+	)
+	tl.scroll = 0
+	if events.Trace != nil {
+		if err := events.StopTrace(); err != nil {
+			fmt.Printf("Could not finish event trace: %v\n", err)
+		}
+		fmt.Printf("Stopped event trace\n")
+		return
+	}
+	if err := StartTrace(events, path); err != nil {
+		fmt.Printf("Could not start event trace: %v\n", err)
+	}
+}
+
+// StartTrace starts tracing every event on events to a JSON lines file at
+// path.
+func StartTrace(events *EventBus, path string) (err error) {
+	var (
+		trace *EventTrace
+	)
+	if trace, err = NewEventTrace(path, TraceKeep); err != nil {
+		return
+	}
+	events.StartTrace(trace)
+	fmt.Printf("Tracing events to %v\n", path)
+	return
+}